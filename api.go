@@ -4,12 +4,25 @@ import (
 	"context"
 	"errors"
 	"log"
+	"os"
+	"time"
 
 	"golang.org/x/oauth2"
 )
 
 type TokenSource interface{}
 
+// tokenKind is a kind of token issued by TokenSource.
+type tokenKind string
+
+const (
+	kindAccessToken tokenKind = "access_token"
+	kindIDToken     tokenKind = "id_token"
+	kindJWT         tokenKind = "jwt"
+	// kindFirebaseIDToken is issued by exchanging custom token signed as kindJWT.
+	kindFirebaseIDToken tokenKind = "firebase_id_token"
+)
+
 type HasAccessTokenWithoutScopes interface {
 	TokenSource
 	AccessTokenWithoutScopes(ctx context.Context) (string, error)
@@ -22,7 +35,7 @@ type HasAccessToken interface {
 
 type HasJWTToken interface {
 	TokenSource
-	JWTToken(ctx context.Context, audience string) (string, error)
+	JWTToken(ctx context.Context, opt jwtOption) (string, error)
 }
 
 type HasIDTokenWithoutAudience interface {
@@ -40,6 +53,17 @@ type HasEmail interface {
 	Email() (string, error)
 }
 
+type HasProject interface {
+	TokenSource
+	Project() (string, error)
+}
+
+// HasExpiry is implemented by token sources which know expiry of the issued token.
+type HasExpiry interface {
+	TokenSource
+	Expiry() (time.Time, error)
+}
+
 func AccessToken(ctx context.Context, tokenSource TokenSource, scopes ...string) (string, error) {
 	switch ts := tokenSource.(type) {
 	case HasAccessToken:
@@ -64,12 +88,17 @@ func IDToken(ctx context.Context, tokenSource TokenSource, audience string) (str
 	}
 }
 
-func JWTToken(ctx context.Context, tokenSource TokenSource, audience string) (string, error) {
+// JWTToken issues self-signed JWT.
+// sourceScopes are used to sign by IAM when tokenSource can't sign by itself.
+func JWTToken(ctx context.Context, tokenSource TokenSource, opt jwtOption, sourceScopes ...string) (string, error) {
 	switch ts := tokenSource.(type) {
 	case HasJWTToken:
-		return ts.JWTToken(ctx, audience)
+		return ts.JWTToken(ctx, opt)
 	default:
-		oauth2TokenSource, err := OAuth2TokenSource(ctx, tokenSource, defaultScopes...)
+		if len(sourceScopes) == 0 {
+			sourceScopes = defaultSourceScopes
+		}
+		oauth2TokenSource, err := OAuth2TokenSource(ctx, tokenSource, sourceScopes...)
 		if err != nil {
 			return "", err
 		}
@@ -77,8 +106,8 @@ func JWTToken(ctx context.Context, tokenSource TokenSource, audience string) (st
 		if err != nil {
 			return "", err
 		}
-		log.Println("JWTToken: fallback to impersonateJWTForAudience. It needs service account token creator")
-		return impersonateJWTForAudience(ctx, oauth2TokenSource, email, nil, audience)
+		log.Println("JWTToken: fallback to impersonateJWTWithOption. It needs service account token creator")
+		return impersonateJWTWithOption(ctx, oauth2TokenSource, email, nil, opt)
 	}
 }
 
@@ -91,6 +120,31 @@ func Email(tokenSource TokenSource) (string, error) {
 	}
 }
 
+func Expiry(tokenSource TokenSource) (time.Time, error) {
+	switch ts := tokenSource.(type) {
+	case HasExpiry:
+		return ts.Expiry()
+	default:
+		return time.Time{}, errors.New("token source hasn't expiry")
+	}
+}
+
+// Project returns the project of tokenSource.
+// It falls back to GOOGLE_CLOUD_PROJECT and CLOUDSDK_CORE_PROJECT environment variables.
+func Project(tokenSource TokenSource) (string, error) {
+	if ts, ok := tokenSource.(HasProject); ok {
+		if project, err := ts.Project(); err == nil && project != "" {
+			return project, nil
+		}
+	}
+	for _, env := range []string{"GOOGLE_CLOUD_PROJECT", "CLOUDSDK_CORE_PROJECT"} {
+		if project := os.Getenv(env); project != "" {
+			return project, nil
+		}
+	}
+	return "", errors.New("token source hasn't project")
+}
+
 func OAuth2TokenSource(ctx context.Context, tokenSource TokenSource, scopes ...string) (oauth2.TokenSource, error) {
 	tokenString, err := AccessToken(ctx, tokenSource, scopes...)
 	if err != nil {
@@ -98,3 +152,23 @@ func OAuth2TokenSource(ctx context.Context, tokenSource TokenSource, scopes ...s
 	}
 	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: tokenString}), nil
 }
+
+// LazyOAuth2TokenSource is like OAuth2TokenSource but issues the access token on first use.
+// It avoids fetching source token when the final token is served from cache.
+func LazyOAuth2TokenSource(ctx context.Context, tokenSource TokenSource, scopes ...string) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(nil, &lazyTokenSource{ctx: ctx, tokenSource: tokenSource, scopes: scopes})
+}
+
+type lazyTokenSource struct {
+	ctx         context.Context
+	tokenSource TokenSource
+	scopes      []string
+}
+
+func (lts *lazyTokenSource) Token() (*oauth2.Token, error) {
+	tokenString, err := AccessToken(lts.ctx, lts.tokenSource, lts.scopes...)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: tokenString}, nil
+}
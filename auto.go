@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/compute/metadata"
+)
+
+// credentialCandidate is a credential source tried by AutoTokenSource.
+type credentialCandidate struct {
+	name string
+	find func() (TokenSource, error)
+}
+
+// AutoTokenSource finds credential in the search order of Application Default Credentials.
+// Skipped sources and their reasons are logged.
+func AutoTokenSource(gcloudOpt gcloudOption) (TokenSource, error) {
+	candidates := []credentialCandidate{
+		{"GOOGLE_APPLICATION_CREDENTIALS", findEnvCredentials},
+		{"well-known file", findWellKnownCredentials},
+		{"Cloud Shell", func() (TokenSource, error) { return CloudShellTokenSource() }},
+		{"gcloud", func() (TokenSource, error) { return GcloudTokenSourceWithOption(gcloudOpt) }},
+		{"metadata server", findMetadataCredentials},
+	}
+
+	var reasons []string
+	for _, c := range candidates {
+		ts, err := c.find()
+		if err != nil {
+			log.Printf("auto: skip %s: %v", c.name, err)
+			reasons = append(reasons, fmt.Sprintf("%s: %v", c.name, err))
+			continue
+		}
+		log.Printf("auto: use %s", c.name)
+		return ts, nil
+	}
+	return nil, fmt.Errorf("no credential is found: %s", strings.Join(reasons, "; "))
+}
+
+func findEnvCredentials() (TokenSource, error) {
+	filename := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if filename == "" {
+		return nil, errors.New("not set")
+	}
+	return credentialsFileTokenSource(filename)
+}
+
+func findWellKnownCredentials() (TokenSource, error) {
+	filename := wellKnownFile()
+	if _, err := os.Stat(filename); err != nil {
+		return nil, fmt.Errorf("%s doesn't exist", filename)
+	}
+	return credentialsFileTokenSource(filename)
+}
+
+func findMetadataCredentials() (TokenSource, error) {
+	if !metadata.OnGCE() {
+		return nil, errors.New("not running on GCE")
+	}
+	return MetadataTokenSourceDefault()
+}
+
+// credentialsFileTokenSource prefers keyFileTokenSource for service account keys
+// because it can issue ID tokens and JWTs by itself.
+func credentialsFileTokenSource(filename string) (TokenSource, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var f struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("invalid credential file %s: %v", filename, err)
+	}
+	if f.Type == "service_account" {
+		return KeyFileTokenSource(b)
+	}
+	return CredentialsFileTokenSource(filename)
+}
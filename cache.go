@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const defaultCacheMinTTL = 5 * time.Minute
+
+// cacheKey identifies a cached token.
+type cacheKey struct {
+	Source    string    `json:"source"`
+	Principal string    `json:"principal,omitempty"`
+	Chain     []string  `json:"chain,omitempty"`
+	Kind      tokenKind `json:"kind"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	Audiences []string  `json:"audiences,omitempty"`
+	// Options is other options which affect the token like JWT claims and lifetime.
+	Options interface{} `json:"options,omitempty"`
+}
+
+func (k cacheKey) id() (string, error) {
+	b, err := json.Marshal(k)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// cacheEntry is stored encrypted in the cache directory.
+type cacheEntry struct {
+	Key     cacheKey  `json:"key"`
+	Token   string    `json:"token"`
+	Expiry  time.Time `json:"expiry"`
+	Created time.Time `json:"created"`
+}
+
+// tokenCache is a persistent token cache shared across invocations.
+type tokenCache struct {
+	dir    string
+	minTTL time.Duration
+}
+
+func newTokenCache(minTTL time.Duration) *tokenCache {
+	return &tokenCache{dir: ocurlCacheDir(), minTTL: minTTL}
+}
+
+// get returns the cached token for key if it remains valid for minTTL.
+// Otherwise it calls fetch while holding the lock of key so parallel processes don't fetch the same token.
+// Tokens whose expiry is unknown are not cached and returned with zero expiry.
+func (tc *tokenCache) get(key cacheKey, fetch func() (string, error), expiry func(token string) (time.Time, error)) (string, time.Time, error) {
+	id, err := key.id()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	unlock, err := lockFile(tc.entryFile(id))
+	if err != nil {
+		log.Println("cache: lock failed:", err)
+		return fetchWithExpiry(fetch, expiry)
+	}
+	defer unlock()
+
+	if entry, err := tc.read(id); err == nil && time.Until(entry.Expiry) > tc.minTTL {
+		log.Println("cache: hit, expires at", entry.Expiry.Format(time.RFC3339))
+		return entry.Token, entry.Expiry, nil
+	}
+
+	token, err := fetch()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	exp, err := expiry(token)
+	if err != nil {
+		log.Println("cache: token is not cached:", err)
+		return token, time.Time{}, nil
+	}
+	if err := tc.write(id, &cacheEntry{Key: key, Token: token, Expiry: exp, Created: time.Now()}); err != nil {
+		log.Println("cache: write failed:", err)
+	}
+	return token, exp, nil
+}
+
+// fetchWithExpiry calls fetch without cache. Unknown expiry is returned as zero.
+func fetchWithExpiry(fetch func() (string, error), expiry func(token string) (time.Time, error)) (string, time.Time, error) {
+	token, err := fetch()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	exp, _ := expiry(token)
+	return token, exp, nil
+}
+
+// sourceName describes the credential source of tokenSource for cache key.
+// It returns empty string for sources which shouldn't be cached.
+func sourceName(tokenSource TokenSource) string {
+	switch ts := tokenSource.(type) {
+	case *staticTokenSource:
+		return ""
+	case *gcloudTokenSource:
+		return "gcloud:" + ts.cfg.Configuration.ActiveConfiguration
+	case *keyFileTokenSource:
+		return "key-file:" + ts.cfg.PrivateKeyID
+	case *wellKnownTokenSource:
+		// Principal of ADC is unknown, so the credential is distinguished by hash.
+		return "well-known:" + ts.identity()
+	case *metadataTokenSource:
+		return "metadata:" + orDefault(ts.account, "default")
+	case *cloudShellTokenSource:
+		return "cloud-shell"
+	case *oidcTokenSource:
+		// Principal is unknown before a token is issued, so the user and the parameters are distinguished by hash.
+		return "oidc:" + ts.opt.TokenURL + ":" + ts.opt.ClientID + ":" + ts.opt.GrantType + ":" +
+			fingerprint(ts.opt.Username, ts.opt.RefreshToken, ts.opt.Params)
+	case *storedCredentialTokenSource:
+		return "credential:" + ts.name + ":" + fingerprint(ts.cred.ClientID, ts.cred.RefreshToken)
+	case *impersonateTokenSource:
+		return "impersonate"
+	case *kmsTokenSource:
+		return "kms:" + ts.keyVersion
+	default:
+		return fmt.Sprintf("%T", tokenSource)
+	}
+}
+
+// fingerprint returns a short hash of values so secrets can distinguish cache keys without being stored in them.
+func fingerprint(values ...interface{}) string {
+	// values are strings and string maps which are always marshalable.
+	b, _ := json.Marshal(values)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// tokenExpiry returns exp claim of JWT-shaped token or falls back to expiry of tokenSource.
+func tokenExpiry(tokenSource TokenSource) func(token string) (time.Time, error) {
+	return func(token string) (time.Time, error) {
+		if isJWT(token) {
+			claims := jwt.MapClaims{}
+			if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+				return time.Time{}, err
+			}
+			if exp, ok := claims["exp"].(float64); ok {
+				return time.Unix(int64(exp), 0), nil
+			}
+			return time.Time{}, errors.New("token hasn't exp claim")
+		}
+		return Expiry(tokenSource)
+	}
+}
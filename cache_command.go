@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func cacheCommand(args []string) {
+	if len(args) == 0 {
+		log.Fatalln("usage: ocurl cache list|purge|warm")
+	}
+	switch args[0] {
+	case "list":
+		cacheListCommand(args[1:])
+	case "purge":
+		cachePurgeCommand(args[1:])
+	case "warm":
+		cacheWarmCommand(args[1:])
+	default:
+		log.Fatalf("unknown cache command: %s", args[0])
+	}
+}
+
+// cacheFilter selects cache entries.
+type cacheFilter struct {
+	principal string
+	kind      string
+	source    string
+	expired   bool
+}
+
+func (f *cacheFilter) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.principal, "principal", "", "Filter by principal")
+	fs.StringVar(&f.kind, "kind", "", "Filter by token kind(access_token, id_token, jwt, firebase_id_token)")
+	fs.StringVar(&f.source, "source", "", "Filter by source prefix")
+	fs.BoolVar(&f.expired, "expired", false, "Only expired entries")
+}
+
+func (f *cacheFilter) match(entry *cacheEntry) bool {
+	switch {
+	case f.principal != "" && entry.Key.Principal != f.principal && lastOrEmpty(entry.Key.Chain) != f.principal:
+		return false
+	case f.kind != "" && string(entry.Key.Kind) != f.kind:
+		return false
+	case f.source != "" && !strings.HasPrefix(entry.Key.Source, f.source):
+		return false
+	case f.expired && time.Now().Before(entry.Expiry):
+		return false
+	}
+	return true
+}
+
+// empty reports whether f selects all entries.
+func (f *cacheFilter) empty() bool {
+	return *f == cacheFilter{}
+}
+
+func sortedEntries(entries map[string]*cacheEntry) []string {
+	var filenames []string
+	for filename := range entries {
+		filenames = append(filenames, filename)
+	}
+	sort.Slice(filenames, func(i, j int) bool {
+		return entries[filenames[i]].Expiry.Before(entries[filenames[j]].Expiry)
+	})
+	return filenames
+}
+
+// cacheListCommand prints cached entries. Token values are never printed.
+func cacheListCommand(args []string) {
+	fs := flag.NewFlagSet("cache list", flag.ExitOnError)
+	var filter cacheFilter
+	filter.register(fs)
+	_ = fs.Parse(args)
+
+	entries, unreadable, err := newTokenCache(0).entries()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	printCacheEntries(os.Stdout, entries, unreadable, &filter)
+}
+
+// printCacheEntries prints entries selected by filter.
+// Unreadable entries can't be filtered, so they are printed only without filter.
+func printCacheEntries(w io.Writer, entries map[string]*cacheEntry, unreadable map[string]error, filter *cacheFilter) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PRINCIPAL\tCHAIN\tKIND\tSCOPES/AUDIENCE\tSOURCE\tREMAINING")
+	for _, filename := range sortedEntries(entries) {
+		entry := entries[filename]
+		if !filter.match(entry) {
+			continue
+		}
+		target := strings.Join(entry.Key.Scopes, ",")
+		if len(entry.Key.Audiences) > 0 {
+			target = strings.Join(entry.Key.Audiences, ",")
+		}
+		remaining := "expired"
+		if d := time.Until(entry.Expiry); d > 0 {
+			remaining = d.Truncate(time.Second).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			orDefault(entry.Key.Principal, "-"),
+			orDefault(strings.Join(entry.Key.Chain, ","), "-"),
+			entry.Key.Kind,
+			orDefault(target, "-"),
+			entry.Key.Source,
+			remaining)
+	}
+	if filter.empty() {
+		var filenames []string
+		for filename := range unreadable {
+			filenames = append(filenames, filename)
+		}
+		sort.Strings(filenames)
+		for _, filename := range filenames {
+			log.Printf("cache: %s: %v", filepath.Base(filename), unreadable[filename])
+			fmt.Fprintf(tw, "-\t-\t-\t-\t%s\tundecryptable\n", filepath.Base(filename))
+		}
+	}
+	tw.Flush()
+}
+
+func cachePurgeCommand(args []string) {
+	fs := flag.NewFlagSet("cache purge", flag.ExitOnError)
+	var filter cacheFilter
+	filter.register(fs)
+	_ = fs.Parse(args)
+
+	tc := newTokenCache(0)
+	entries, unreadable, err := tc.entries()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var filenames []string
+	for filename, entry := range entries {
+		if filter.match(entry) {
+			filenames = append(filenames, filename)
+		}
+	}
+	// entries encrypted by another key like before OCURL_CACHE_KEY is changed are purged only without filter
+	if filter.empty() {
+		for filename := range unreadable {
+			filenames = append(filenames, filename)
+		}
+	}
+	for _, filename := range filenames {
+		if err := os.Remove(filename); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	log.Printf("Purged %d entries", len(filenames))
+
+	if filter.empty() {
+		locks, err := tc.staleLocks()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, lock := range locks {
+			if err := os.Remove(lock); err != nil {
+				log.Fatalln(err)
+			}
+		}
+	}
+}
+
+// cacheWarmCommand prefetches tokens for each line of profile and/or the remaining arguments.
+// Each line of profile is a whitespace separated list of ocurl flags. Empty lines and lines starting with # are ignored.
+func cacheWarmCommand(args []string) {
+	fs := flag.NewFlagSet("cache warm", flag.ExitOnError)
+	profile := fs.String("profile", "", "File of ocurl flag sets, one per line")
+	minTTL := fs.Duration("min-ttl", defaultCacheMinTTL, "Refresh tokens which don't remain valid for this duration")
+	_ = fs.Parse(args)
+
+	var flagSets [][]string
+	if *profile != "" {
+		b, err := ioutil.ReadFile(*profile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		scanner := bufio.NewScanner(strings.NewReader(string(b)))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			flagSets = append(flagSets, strings.Fields(line))
+		}
+	}
+	if fs.NArg() > 0 {
+		flagSets = append(flagSets, fs.Args())
+	}
+	if len(flagSets) == 0 {
+		log.Fatalln("--profile or ocurl flags are required")
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var failed int
+	for _, flags := range flagSets {
+		args := append([]string{"-print-token", "-cache-min-ttl", minTTL.String()}, flags...)
+		cmd := exec.Command(self, args...)
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			log.Printf("warm failed: %s: %v", strings.Join(flags, " "), err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		log.Fatalf("%d of %d warm failed", failed, len(flagSets))
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	cacheKeyFile      = "key"
+	cacheEntrySuffix  = ".token"
+	cacheLockSuffix   = ".lock"
+	lockTimeout       = 30 * time.Second
+	lockRetryInterval = 50 * time.Millisecond
+)
+
+func ocurlCacheDir() string {
+	if dir := os.Getenv("OCURL_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("LOCALAPPDATA"), "ocurl", "cache")
+	}
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "ocurl")
+	}
+	return filepath.Join(guessUnixHomeDir(), ".cache", "ocurl")
+}
+
+func (tc *tokenCache) entryFile(id string) string {
+	return filepath.Join(tc.dir, id+cacheEntrySuffix)
+}
+
+func (tc *tokenCache) read(id string) (*cacheEntry, error) {
+	return tc.readFile(tc.entryFile(id))
+}
+
+func (tc *tokenCache) readFile(filename string) (*cacheEntry, error) {
+	ciphertext, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := tc.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("cache entry is truncated")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't decrypt cache entry: %v", err)
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(plaintext, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (tc *tokenCache) write(id string, entry *cacheEntry) error {
+	plaintext, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	aead, err := tc.aead()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	ciphertext := aead.Seal(nonce, nonce, plaintext, nil)
+
+	// write to temporary file and rename to avoid partially written entries
+	tmp, err := ioutil.TempFile(tc.dir, id+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(ciphertext); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), tc.entryFile(id))
+}
+
+// aead returns AES-GCM keyed by $OCURL_CACHE_KEY or the key file in the cache directory.
+// The key file sits next to the entries, so it only protects entries copied without it.
+func (tc *tokenCache) aead() (cipher.AEAD, error) {
+	var key []byte
+	if passphrase := os.Getenv("OCURL_CACHE_KEY"); passphrase != "" {
+		sum := sha256.Sum256([]byte(passphrase))
+		key = sum[:]
+	} else {
+		var err error
+		key, err = tc.loadOrCreateKey()
+		if err != nil {
+			return nil, err
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (tc *tokenCache) loadOrCreateKey() ([]byte, error) {
+	filename := filepath.Join(tc.dir, cacheKeyFile)
+	key, err := ioutil.ReadFile(filename)
+	if err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	// a key of invalid size is left by older versions killed while writing it
+	corrupted := err == nil
+	if corrupted {
+		log.Printf("cache: replace key of invalid size %d", len(key))
+	}
+
+	if err := os.MkdirAll(tc.dir, 0700); err != nil {
+		return nil, err
+	}
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	// write to temporary file so other processes never see a partially written key
+	tmp, err := ioutil.TempFile(tc.dir, cacheKeyFile+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(key); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	if !corrupted {
+		// link doesn't replace the key created by another process concurrently
+		err := os.Link(tmp.Name(), filename)
+		if err == nil {
+			return key, nil
+		}
+		if os.IsExist(err) {
+			return readKey(filename)
+		}
+		// fall back to rename on file systems without hard links
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return nil, err
+	}
+	// another process may have replaced it concurrently
+	return readKey(filename)
+}
+
+func readKey(filename string) ([]byte, error) {
+	key, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid cache key %s: size %d", filename, len(key))
+	}
+	return key, nil
+}
+
+// entries returns cache entries keyed by their file names.
+// Entries which can't be read like those encrypted by another key are returned in unreadable with the reasons.
+func (tc *tokenCache) entries() (entries map[string]*cacheEntry, unreadable map[string]error, err error) {
+	files, err := ioutil.ReadDir(tc.dir)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	entries = make(map[string]*cacheEntry)
+	unreadable = make(map[string]error)
+	for _, fi := range files {
+		if !strings.HasSuffix(fi.Name(), cacheEntrySuffix) {
+			continue
+		}
+		filename := filepath.Join(tc.dir, fi.Name())
+		entry, err := tc.readFile(filename)
+		if err != nil {
+			unreadable[filename] = err
+			continue
+		}
+		entries[filename] = entry
+	}
+	return entries, unreadable, nil
+}
+
+// staleLocks returns lock files of cache entries which are not held by any process.
+func (tc *tokenCache) staleLocks() ([]string, error) {
+	locks, err := filepath.Glob(filepath.Join(tc.dir, "*"+cacheEntrySuffix+cacheLockSuffix))
+	if err != nil {
+		return nil, err
+	}
+	var stale []string
+	for _, lock := range locks {
+		if lockStale(lock) {
+			stale = append(stale, lock)
+		}
+	}
+	return stale, nil
+}
@@ -0,0 +1,66 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockFile acquires an exclusive lock of filename by creating a lock file.
+// Advisory locks are not available, so lock files left by interrupted processes are removed when they are older than lockTimeout.
+// The lock file records its owner so a stale-removed holder doesn't remove the lock of another process.
+func lockFile(filename string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return nil, err
+	}
+	owner := make([]byte, 16)
+	if _, err := rand.Read(owner); err != nil {
+		return nil, err
+	}
+	owner = []byte(hex.EncodeToString(owner))
+	lock := filename + cacheLockSuffix
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			_, err = f.Write(owner)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(lock)
+				return nil, err
+			}
+			return func() {
+				if b, err := ioutil.ReadFile(lock); err == nil && bytes.Equal(b, owner) {
+					os.Remove(lock)
+				}
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if fi, err := os.Stat(lock); err == nil && time.Since(fi.ModTime()) > lockTimeout {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timeout to lock %s", filename)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// lockStale reports whether lock is older than lockTimeout.
+func lockStale(lock string) bool {
+	fi, err := os.Stat(lock)
+	return err == nil && time.Since(fi.ModTime()) > lockTimeout
+}
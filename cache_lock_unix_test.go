@@ -0,0 +1,41 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockFileReleasedOnExit(t *testing.T) {
+	if filename := os.Getenv("OCURL_TEST_LOCK_AND_EXIT"); filename != "" {
+		if _, err := lockFile(filename); err != nil {
+			os.Exit(2)
+		}
+		// exit without unlock like log.Fatal or a signal
+		os.Exit(1)
+	}
+
+	filename := filepath.Join(t.TempDir(), "entry"+cacheEntrySuffix)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockFileReleasedOnExit$")
+	cmd.Env = append(os.Environ(), "OCURL_TEST_LOCK_AND_EXIT="+filename)
+	if err := cmd.Run(); err == nil {
+		t.Fatal("helper process should exit with status 1")
+	} else if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("helper process failed: %v", err)
+	}
+
+	start := time.Now()
+	unlock, err := lockFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	if elapsed := time.Since(start); elapsed > lockRetryInterval {
+		t.Errorf("lock left by the exited process blocked %v", elapsed)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSourceNameDistinguishesIdentity(t *testing.T) {
+	base := oidcOption{TokenURL: "https://issuer.example.com/token", ClientID: "client", GrantType: grantClientCredentials}
+	withParams := func(opt oidcOption, params map[string]string) oidcOption {
+		opt.Params = params
+		return opt
+	}
+	withUser := func(opt oidcOption, username, refreshToken string) oidcOption {
+		opt.Username = username
+		opt.RefreshToken = refreshToken
+		return opt
+	}
+	cred := &storedCredential{ClientID: "client", RefreshToken: "rt"}
+	for _, tt := range []struct {
+		name string
+		a, b TokenSource
+	}{
+		{
+			name: "oidc audience",
+			a:    &oidcTokenSource{opt: withParams(base, map[string]string{"audience": "https://a.example.com"})},
+			b:    &oidcTokenSource{opt: withParams(base, map[string]string{"audience": "https://b.example.com"})},
+		},
+		{
+			name: "oidc username",
+			a:    &oidcTokenSource{opt: withUser(base, "alice", "")},
+			b:    &oidcTokenSource{opt: withUser(base, "bob", "")},
+		},
+		{
+			name: "oidc refresh token",
+			a:    &oidcTokenSource{opt: withUser(base, "", "rt1")},
+			b:    &oidcTokenSource{opt: withUser(base, "", "rt2")},
+		},
+		{
+			name: "credential name",
+			a:    &storedCredentialTokenSource{name: "default", cred: cred},
+			b:    &storedCredentialTokenSource{name: "other", cred: cred},
+		},
+		{
+			name: "credential refresh token",
+			a:    &storedCredentialTokenSource{name: "default", cred: cred},
+			b:    &storedCredentialTokenSource{name: "default", cred: &storedCredential{ClientID: "client", RefreshToken: "rt2"}},
+		},
+		{
+			name: "well-known authorized_user",
+			a:    &wellKnownTokenSource{[]byte(`{"type": "authorized_user", "client_id": "client", "refresh_token": "rt-a"}`)},
+			b:    &wellKnownTokenSource{[]byte(`{"type": "authorized_user", "client_id": "client", "refresh_token": "rt-b"}`)},
+		},
+		{
+			name: "well-known external_account",
+			a:    &wellKnownTokenSource{[]byte(`{"type": "external_account", "audience": "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/a/providers/p", "subject_token_type": "urn:ietf:params:oauth:token-type:jwt"}`)},
+			b:    &wellKnownTokenSource{[]byte(`{"type": "external_account", "audience": "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/b/providers/p", "subject_token_type": "urn:ietf:params:oauth:token-type:jwt"}`)},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := sourceName(tt.a), sourceName(tt.b)
+			if a == b {
+				t.Errorf("sourceName() = %s for both", a)
+			}
+		})
+	}
+}
+
+func TestLoadOrCreateKeyConcurrently(t *testing.T) {
+	tc := &tokenCache{dir: t.TempDir()}
+	keys := make([][]byte, 16)
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i := range keys {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			keys[i], errs[i] = tc.loadOrCreateKey()
+		}(i)
+	}
+	wg.Wait()
+	for i := range keys {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if !bytes.Equal(keys[i], keys[0]) {
+			t.Fatalf("key %d differs: %x, %x", i, keys[i], keys[0])
+		}
+	}
+}
+
+func TestLoadOrCreateKeyReplacesCorrupted(t *testing.T) {
+	tc := &tokenCache{dir: t.TempDir()}
+	filename := filepath.Join(tc.dir, cacheKeyFile)
+	// left by a process killed between creating and writing the key file
+	if err := ioutil.WriteFile(filename, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	key, err := tc.loadOrCreateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("loadOrCreateKey() took %v", elapsed)
+	}
+	stored, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 32 || !bytes.Equal(key, stored) {
+		t.Errorf("loadOrCreateKey() = %x, stored %x", key, stored)
+	}
+	files, err := ioutil.ReadDir(tc.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("temporary files are left: %d files", len(files))
+	}
+}
+
+func TestLockFileExcludes(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "entry"+cacheEntrySuffix)
+	unlock, err := lockFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan func())
+	go func() {
+		unlock, err := lockFile(filename)
+		if err != nil {
+			t.Error(err)
+			close(acquired)
+			return
+		}
+		acquired <- unlock
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("lock is acquired twice")
+	case <-time.After(4 * lockRetryInterval):
+	}
+	unlock()
+	select {
+	case unlock2, ok := <-acquired:
+		if ok {
+			unlock2()
+		}
+	case <-time.After(lockTimeout):
+		t.Fatal("lock isn't released")
+	}
+}
+
+func TestEntriesUnreadableAndStaleLocks(t *testing.T) {
+	tc := &tokenCache{dir: t.TempDir()}
+	t.Setenv("OCURL_CACHE_KEY", "old")
+	if err := tc.write("old", &cacheEntry{Token: "token", Expiry: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OCURL_CACHE_KEY", "new")
+	if err := tc.write("new", &cacheEntry{Token: "token", Expiry: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	entries, unreadable, err := tc.entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entries[tc.entryFile("new")]; !ok || len(entries) != 1 {
+		t.Errorf("entries() = %v", entries)
+	}
+	if _, ok := unreadable[tc.entryFile("old")]; !ok || len(unreadable) != 1 {
+		t.Errorf("unreadable = %v", unreadable)
+	}
+
+	held, err := lockFile(tc.entryFile("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held()
+	released, err := lockFile(tc.entryFile("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	released()
+	// make the released lock stale also for lock files without advisory lock
+	past := time.Now().Add(-2 * lockTimeout)
+	os.Chtimes(tc.entryFile("old")+cacheLockSuffix, past, past)
+
+	stale, err := tc.staleLocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale[0] != tc.entryFile("old")+cacheLockSuffix {
+		t.Errorf("staleLocks() = %v", stale)
+	}
+}
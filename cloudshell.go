@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const devshellPortEnv = "DEVSHELL_CLIENT_PORT"
+
+// cloudShellTokenSource uses the devshell credential server of Cloud Shell.
+type cloudShellTokenSource struct {
+	port int
+
+	once sync.Once
+	info *devshellCredential
+	err  error
+}
+
+// devshellCredential is the response of devshell credential server.
+type devshellCredential struct {
+	Email       string
+	ProjectID   string
+	AccessToken string
+	Expiry      time.Time
+}
+
+func CloudShellTokenSource() (*cloudShellTokenSource, error) {
+	v := os.Getenv(devshellPortEnv)
+	if v == "" {
+		return nil, errors.New(devshellPortEnv + " is not set")
+	}
+	port, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, errors.New(devshellPortEnv + " is invalid: " + v)
+	}
+	return &cloudShellTokenSource{port: port}, nil
+}
+
+func (csts *cloudShellTokenSource) credential(ctx context.Context) (*devshellCredential, error) {
+	csts.once.Do(func() {
+		csts.info, csts.err = fetchDevshellCredential(ctx, csts.port)
+	})
+	return csts.info, csts.err
+}
+
+func (csts *cloudShellTokenSource) AccessTokenWithoutScopes(ctx context.Context) (string, error) {
+	info, err := csts.credential(ctx)
+	if err != nil {
+		return "", err
+	}
+	return info.AccessToken, nil
+}
+
+func (csts *cloudShellTokenSource) Email() (string, error) {
+	info, err := csts.credential(context.Background())
+	if err != nil {
+		return "", err
+	}
+	return info.Email, nil
+}
+
+func (csts *cloudShellTokenSource) Project() (string, error) {
+	info, err := csts.credential(context.Background())
+	if err != nil {
+		return "", err
+	}
+	return info.ProjectID, nil
+}
+
+func (csts *cloudShellTokenSource) Expiry() (time.Time, error) {
+	info, err := csts.credential(context.Background())
+	if err != nil {
+		return time.Time{}, err
+	}
+	if info.Expiry.IsZero() {
+		return time.Time{}, errors.New("devshell credential has no expiry")
+	}
+	return info.Expiry, nil
+}
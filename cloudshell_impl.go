@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// devshellRequest is the credential request of devshell protocol.
+const devshellRequest = "[]"
+
+// devshellMaxResponse limits the response length to avoid huge allocation by broken servers.
+const devshellMaxResponse = 1 << 20
+
+// fetchDevshellCredential speaks the devshell protocol.
+// Both request and response are JSON arrays prefixed by its length and a newline.
+// The response is [email, project_id, access_token, expires_in].
+func fetchDevshellCredential(ctx context.Context, port int) (*devshellCredential, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else {
+		_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	}
+
+	if _, err := fmt.Fprintf(conn, "%d\n%s", len(devshellRequest), devshellRequest); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("invalid devshell response: %v", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(header))
+	if err != nil || n < 0 || n > devshellMaxResponse {
+		return nil, fmt.Errorf("invalid devshell response length: %q", header)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("invalid devshell response: %v", err)
+	}
+
+	var fields []interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("invalid devshell response: %v", err)
+	}
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("devshell response has no access token: %s", body)
+	}
+	var info devshellCredential
+	info.Email, _ = fields[0].(string)
+	info.ProjectID, _ = fields[1].(string)
+	info.AccessToken, _ = fields[2].(string)
+	if info.AccessToken == "" {
+		return nil, fmt.Errorf("devshell response has no access token: %s", body)
+	}
+	if len(fields) > 3 {
+		if expiresIn, ok := fields[3].(float64); ok {
+			info.Expiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+		}
+	}
+	return &info, nil
+}
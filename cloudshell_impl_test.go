@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDevshell serves one devshell connection per response.
+// write sends the response and can split or corrupt the frame.
+func fakeDevshell(t *testing.T, write func(conn net.Conn)) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		header, err := r.ReadString('\n')
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(header))
+		if err != nil {
+			t.Errorf("invalid request length: %q", header)
+			return
+		}
+		body := make([]byte, n)
+		if _, err := io.ReadFull(r, body); err != nil {
+			t.Error(err)
+			return
+		}
+		if string(body) != devshellRequest {
+			t.Errorf("request: %s", body)
+		}
+		write(conn)
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func framed(body string) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		fmt.Fprintf(conn, "%d\n%s", len(body), body)
+	}
+}
+
+func TestFetchDevshellCredential(t *testing.T) {
+	const response = `["me@example.com","my-project","ya29.token",3600]`
+	for _, tt := range []struct {
+		name       string
+		write      func(conn net.Conn)
+		wantToken  string
+		wantExpiry bool
+		wantErr    string
+	}{
+		{name: "success", write: framed(response), wantToken: "ya29.token", wantExpiry: true},
+		{name: "without expiry", write: framed(`["me@example.com","my-project","ya29.token"]`), wantToken: "ya29.token"},
+		{
+			name: "split frame",
+			write: func(conn net.Conn) {
+				fmt.Fprintf(conn, "%d", len(response))
+				time.Sleep(10 * time.Millisecond)
+				fmt.Fprint(conn, "\n"+response[:10])
+				time.Sleep(10 * time.Millisecond)
+				fmt.Fprint(conn, response[10:])
+			},
+			wantToken:  "ya29.token",
+			wantExpiry: true,
+		},
+		{name: "invalid length", write: func(conn net.Conn) { fmt.Fprint(conn, "abc\n[]") }, wantErr: "length"},
+		{name: "negative length", write: func(conn net.Conn) { fmt.Fprint(conn, "-1\n[]") }, wantErr: "length"},
+		{name: "too long", write: func(conn net.Conn) { fmt.Fprint(conn, "999999999\n[]") }, wantErr: "length"},
+		{name: "truncated body", write: func(conn net.Conn) { fmt.Fprintf(conn, "%d\n%s", len(response)+10, response) }, wantErr: "invalid devshell response"},
+		{name: "no access token", write: framed(`["me@example.com","my-project"]`), wantErr: "no access token"},
+		{name: "not array", write: framed(`{}`), wantErr: "invalid devshell response"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			port := fakeDevshell(t, tt.write)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			info, err := fetchDevshellCredential(ctx, port)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("want error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.AccessToken != tt.wantToken || info.Email != "me@example.com" || info.ProjectID != "my-project" {
+				t.Errorf("unexpected credential: %+v", info)
+			}
+			if info.Expiry.IsZero() == tt.wantExpiry {
+				t.Errorf("expiry: %v", info.Expiry)
+			}
+		})
+	}
+}
+
+func TestCloudShellTokenSource(t *testing.T) {
+	port := fakeDevshell(t, framed(`["me@example.com","my-project","ya29.token",3600]`))
+	defer os.Unsetenv(devshellPortEnv)
+	os.Setenv(devshellPortEnv, strconv.Itoa(port))
+
+	ts, err := CloudShellTokenSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the credential is fetched once and shared by all methods
+	token, err := AccessToken(context.Background(), ts)
+	if err != nil || token != "ya29.token" {
+		t.Fatalf("got %q, %v", token, err)
+	}
+	if email, _ := Email(ts); email != "me@example.com" {
+		t.Errorf("email: %s", email)
+	}
+	if project, _ := ts.Project(); project != "my-project" {
+		t.Errorf("project: %s", project)
+	}
+}
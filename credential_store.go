@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const defaultCredentialName = "default"
+
+// storedCredential is a user credential saved by ocurl login.
+// It is compatible with authorized_user credential file of Application Default Credentials.
+type storedCredential struct {
+	Type         string   `json:"type"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	RefreshToken string   `json:"refresh_token"`
+	TokenURI     string   `json:"token_uri"`
+	Scopes       []string `json:"scopes,omitempty"`
+	Account      string   `json:"account,omitempty"`
+}
+
+func ocurlConfigDir() string {
+	if dir := os.Getenv("OCURL_CONFIG"); dir != "" {
+		return dir
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("APPDATA"), "ocurl")
+	}
+	return filepath.Join(guessUnixHomeDir(), ".config", "ocurl")
+}
+
+func credentialFile(name string) string {
+	return filepath.Join(ocurlConfigDir(), "credentials", name+".json")
+}
+
+// validateCredentialName rejects names which escape the credentials directory.
+func validateCredentialName(name string) error {
+	if name == "" || name == "." || strings.Contains(name, "..") || strings.ContainsAny(name, `/\`) || filepath.VolumeName(name) != "" {
+		return fmt.Errorf("invalid credential name %q", name)
+	}
+	return nil
+}
+
+func saveCredential(name string, cred *storedCredential) error {
+	if err := validateCredentialName(name); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(cred, "", "  ")
+	if err != nil {
+		return err
+	}
+	filename := credentialFile(name)
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, b, 0600)
+}
+
+func loadCredential(name string) (*storedCredential, error) {
+	if err := validateCredentialName(name); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(credentialFile(name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("credential %s is not found, run ocurl login", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cred storedCredential
+	if err := json.Unmarshal(b, &cred); err != nil {
+		return nil, err
+	}
+	if cred.RefreshToken == "" {
+		return nil, fmt.Errorf("credential %s has no refresh token", name)
+	}
+	return &cred, nil
+}
+
+type storedCredentialTokenSource struct {
+	name string
+	cred *storedCredential
+
+	once  sync.Once
+	token *oauth2.Token
+	err   error
+}
+
+// StoredCredentialTokenSource uses the credential saved by ocurl login.
+func StoredCredentialTokenSource(name string) (*storedCredentialTokenSource, error) {
+	name = orDefault(name, defaultCredentialName)
+	cred, err := loadCredential(name)
+	if err != nil {
+		return nil, err
+	}
+	return &storedCredentialTokenSource{name: name, cred: cred}, nil
+}
+
+func (scts *storedCredentialTokenSource) refresh(ctx context.Context) (*oauth2.Token, error) {
+	scts.once.Do(func() {
+		cfg := &oauth2.Config{
+			ClientID:     scts.cred.ClientID,
+			ClientSecret: scts.cred.ClientSecret,
+			Endpoint:     oauth2.Endpoint{TokenURL: scts.cred.TokenURI},
+		}
+		scts.token, scts.err = cfg.TokenSource(ctx, &oauth2.Token{RefreshToken: scts.cred.RefreshToken}).Token()
+	})
+	return scts.token, scts.err
+}
+
+func (scts *storedCredentialTokenSource) Email() (string, error) {
+	if scts.cred.Account == "" {
+		return "", errors.New("credential hasn't account")
+	}
+	return scts.cred.Account, nil
+}
+
+func (scts *storedCredentialTokenSource) AccessTokenWithoutScopes(ctx context.Context) (string, error) {
+	token, err := scts.refresh(ctx)
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+func (scts *storedCredentialTokenSource) IDTokenWithoutAudience(ctx context.Context) (string, error) {
+	token, err := scts.refresh(ctx)
+	if err != nil {
+		return "", err
+	}
+	idToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return "", errors.New("token response has no id_token, login with openid scope")
+	}
+	return idToken, nil
+}
+
+func (scts *storedCredentialTokenSource) Expiry() (time.Time, error) {
+	token, err := scts.refresh(context.Background())
+	if err != nil {
+		return time.Time{}, err
+	}
+	return token.Expiry, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidateCredentialName(t *testing.T) {
+	for _, name := range []string{"default", "work", "user@example.com", "my-cred_1"} {
+		if err := validateCredentialName(name); err != nil {
+			t.Errorf("validateCredentialName(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", ".", "..", "../../x", "a/b", `a\b`, "/etc/passwd", "..hidden"} {
+		if err := validateCredentialName(name); err == nil {
+			t.Errorf("validateCredentialName(%q) should fail", name)
+		}
+	}
+}
+
+func TestSaveCredentialRejectsTraversal(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("OCURL_CONFIG", dir)
+	if err := saveCredential("../../x", &storedCredential{RefreshToken: "rt"}); err == nil {
+		t.Error("saveCredential should reject name escaping the credentials directory")
+	}
+	if _, err := loadCredential("../x"); err == nil {
+		t.Error("loadCredential should reject name escaping the credentials directory")
+	}
+}
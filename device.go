@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	deviceCodeGrantType   = "urn:ietf:params:oauth:grant-type:device_code"
+	googleDeviceAuthURL   = "https://oauth2.googleapis.com/device/code"
+	defaultDeviceInterval = 5 * time.Second
+	slowDownIncrement     = 5 * time.Second
+)
+
+// googleDeviceScopes are scopes allowed in device authorization grant of Google.
+var googleDeviceScopes = []string{
+	"openid",
+	"email",
+	"profile",
+	"https://www.googleapis.com/auth/userinfo.email",
+	"https://www.googleapis.com/auth/userinfo.profile",
+	"https://www.googleapis.com/auth/drive.appdata",
+	"https://www.googleapis.com/auth/drive.file",
+	"https://www.googleapis.com/auth/youtube",
+	"https://www.googleapis.com/auth/youtube.readonly",
+}
+
+// defaultDeviceLoginScopes is used for Google device authorization grant which doesn't allow cloud-platform.
+var defaultDeviceLoginScopes = []string{"openid", "email"}
+
+// deviceTimeAfter waits polling interval. It is replaced in tests.
+var deviceTimeAfter = time.After
+
+// checkGoogleDeviceScopes rejects scopes which Google device authorization grant doesn't allow
+// because Google responds only invalid_scope.
+func checkGoogleDeviceScopes(scopes []string) error {
+	for _, s := range scopes {
+		if !contains(googleDeviceScopes, s) {
+			return fmt.Errorf("scope %s is not allowed in device authorization of Google. Use login without --device", s)
+		}
+	}
+	return nil
+}
+
+// deviceAuthResponse is the response of device authorization endpoint(RFC 8628).
+type deviceAuthResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	// VerificationURL is used by Google instead of verification_uri.
+	VerificationURL string `json:"verification_url"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Interval        int64  `json:"interval"`
+}
+
+// deviceLogin runs OAuth2 device authorization grant.
+// The verification URL and user code are printed to w.
+func deviceLogin(ctx context.Context, cfg *oauth2.Config, deviceAuthURL string, w io.Writer) (*oauth2.Token, error) {
+	v := url.Values{}
+	v.Set("client_id", cfg.ClientID)
+	v.Set("scope", strings.Join(cfg.Scopes, " "))
+	var auth deviceAuthResponse
+	if err := postForm(ctx, deviceAuthURL, v, &auth); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(w, "Go to the following URL and enter the code %s\n\n    %s\n\n", auth.UserCode, orDefault(auth.VerificationURI, auth.VerificationURL))
+	if auth.VerificationURIComplete != "" {
+		fmt.Fprintf(w, "or open\n\n    %s\n\n", auth.VerificationURIComplete)
+	}
+
+	interval := defaultDeviceInterval
+	if auth.Interval > 0 {
+		interval = time.Duration(auth.Interval) * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
+
+	v = url.Values{}
+	v.Set("grant_type", deviceCodeGrantType)
+	v.Set("device_code", auth.DeviceCode)
+	v.Set("client_id", cfg.ClientID)
+	if cfg.ClientSecret != "" {
+		v.Set("client_secret", cfg.ClientSecret)
+	}
+	for {
+		if auth.ExpiresIn > 0 && time.Now().After(deadline) {
+			return nil, errors.New("device code is expired")
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deviceTimeAfter(interval):
+		}
+
+		// pending states are returned as error responses
+		var raw map[string]interface{}
+		if err := postForm(ctx, cfg.Endpoint.TokenURL, v, &raw); err != nil && raw["error"] == nil {
+			return nil, err
+		}
+		switch raw["error"] {
+		case nil:
+			return tokenFromJSON(raw)
+		case "authorization_pending":
+		case "slow_down":
+			interval += slowDownIncrement
+		case "access_denied":
+			return nil, errors.New("authorization is denied")
+		case "expired_token":
+			return nil, errors.New("device code is expired")
+		default:
+			return nil, fmt.Errorf("device authorization failed: %v %v", raw["error"], raw["error_description"])
+		}
+	}
+}
+
+// postForm posts v and decodes JSON response into out.
+// It returns an error for non-2xx responses even if decoding succeeds.
+func postForm(ctx context.Context, endpoint string, v url.Values, out interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("invalid response from %s: %v", endpoint, err)
+	}
+	if c := resp.StatusCode; c < 200 || c > 299 {
+		return &oauth2.RetrieveError{Response: resp, Body: body}
+	}
+	return nil
+}
+
+func tokenFromJSON(raw map[string]interface{}) (*oauth2.Token, error) {
+	accessToken, _ := raw["access_token"].(string)
+	if accessToken == "" {
+		return nil, errors.New("token response has no access_token")
+	}
+	token := &oauth2.Token{AccessToken: accessToken}
+	token.TokenType, _ = raw["token_type"].(string)
+	token.RefreshToken, _ = raw["refresh_token"].(string)
+	if expiresIn, ok := raw["expires_in"].(float64); ok && expiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	}
+	return token.WithExtra(raw), nil
+}
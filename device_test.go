@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestDeviceLogin(t *testing.T) {
+	pending := map[string]interface{}{"error": "authorization_pending"}
+	slowDown := map[string]interface{}{"error": "slow_down"}
+	success := map[string]interface{}{"access_token": "at", "refresh_token": "rt", "token_type": "Bearer", "expires_in": 3600}
+	for _, tt := range []struct {
+		name          string
+		responses     []map[string]interface{}
+		wantIntervals []time.Duration
+		wantErr       string
+	}{
+		{
+			name:          "pending then success",
+			responses:     []map[string]interface{}{pending, pending, success},
+			wantIntervals: []time.Duration{5 * time.Second, 5 * time.Second, 5 * time.Second},
+		},
+		{
+			name:          "slow_down increases interval",
+			responses:     []map[string]interface{}{pending, slowDown, pending, slowDown, success},
+			wantIntervals: []time.Duration{5 * time.Second, 5 * time.Second, 10 * time.Second, 10 * time.Second, 15 * time.Second},
+		},
+		{
+			name:      "denied",
+			responses: []map[string]interface{}{pending, {"error": "access_denied"}},
+			wantErr:   "denied",
+		},
+		{
+			name:      "expired",
+			responses: []map[string]interface{}{{"error": "expired_token"}},
+			wantErr:   "expired",
+		},
+		{
+			name:      "unknown error",
+			responses: []map[string]interface{}{{"error": "invalid_client", "error_description": "bad client"}},
+			wantErr:   "bad client",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var polls int
+			mux := http.NewServeMux()
+			mux.HandleFunc("/device/code", func(w http.ResponseWriter, r *http.Request) {
+				if got := r.FormValue("scope"); got != "openid email" {
+					t.Errorf("scope: %s", got)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"device_code": "dc", "user_code": "ABCD-EFGH", "verification_url": "https://www.google.com/device", "expires_in": 1800, "interval": 5,
+				})
+			})
+			mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+				if r.FormValue("grant_type") != deviceCodeGrantType || r.FormValue("device_code") != "dc" || r.FormValue("client_secret") != "secret" {
+					t.Errorf("unexpected token request: %v", r.Form)
+				}
+				resp := tt.responses[polls]
+				polls++
+				w.Header().Set("Content-Type", "application/json")
+				if resp["error"] != nil {
+					w.WriteHeader(http.StatusBadRequest)
+				}
+				_ = json.NewEncoder(w).Encode(resp)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			var intervals []time.Duration
+			deviceTimeAfter = func(d time.Duration) <-chan time.Time {
+				intervals = append(intervals, d)
+				ch := make(chan time.Time, 1)
+				ch <- time.Now()
+				return ch
+			}
+			defer func() { deviceTimeAfter = time.After }()
+
+			cfg := &oauth2.Config{
+				ClientID:     "client",
+				ClientSecret: "secret",
+				Endpoint:     oauth2.Endpoint{TokenURL: server.URL + "/token"},
+				Scopes:       []string{"openid", "email"},
+			}
+			var out strings.Builder
+			token, err := deviceLogin(context.Background(), cfg, server.URL+"/device/code", &out)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("want error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.AccessToken != "at" || token.RefreshToken != "rt" {
+				t.Errorf("unexpected token: %+v", token)
+			}
+			if !reflect.DeepEqual(intervals, tt.wantIntervals) {
+				t.Errorf("intervals: got %v, want %v", intervals, tt.wantIntervals)
+			}
+			if !strings.Contains(out.String(), "ABCD-EFGH") || !strings.Contains(out.String(), "https://www.google.com/device") {
+				t.Errorf("user code and verification URL are not printed: %s", out.String())
+			}
+		})
+	}
+}
+
+func TestCheckGoogleDeviceScopes(t *testing.T) {
+	for _, tt := range []struct {
+		scopes  []string
+		wantErr bool
+	}{
+		{defaultDeviceLoginScopes, false},
+		{normalizeScopes([]string{"openid", "email", "drive.file"}), false},
+		{defaultLoginScopes, true},
+	} {
+		if err := checkGoogleDeviceScopes(tt.scopes); (err != nil) != tt.wantErr {
+			t.Errorf("%v: got %v", tt.scopes, err)
+		}
+	}
+}
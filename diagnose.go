@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+// Permissions which are granted by roles/iam.serviceAccountTokenCreator.
+const (
+	permissionGetAccessToken     = "iam.serviceAccounts.getAccessToken"
+	permissionGetOpenIDToken     = "iam.serviceAccounts.getOpenIdToken"
+	permissionSignJwt            = "iam.serviceAccounts.signJwt"
+	permissionImplicitDelegation = "iam.serviceAccounts.implicitDelegation"
+)
+
+var tokenCreatorPermissions = []string{
+	permissionGetAccessToken,
+	permissionGetOpenIDToken,
+	permissionSignJwt,
+	permissionImplicitDelegation,
+}
+
+func requiredPermission(kind tokenKind) string {
+	switch kind {
+	case kindIDToken:
+		return permissionGetOpenIDToken
+	case kindJWT:
+		return permissionSignJwt
+	default:
+		return permissionGetAccessToken
+	}
+}
+
+// chainDiagnosis configures diagnoseImpersonateChain.
+type chainDiagnosis struct {
+	// Caller is the name of source credential which is used only for report.
+	Caller string
+	// Chain is the impersonate chain in near to far order. The last element is the target.
+	Chain []string
+	// Kind is the kind of token requested to the target.
+	Kind     tokenKind
+	Audience string
+	// TestIamPermissions enables testIamPermissions on each service account as the previous hop.
+	TestIamPermissions bool
+}
+
+// diagnoseImpersonateChain walks the impersonate chain hop by hop and reports to w.
+// It returns an error which describes the first failed edge.
+func diagnoseImpersonateChain(ctx context.Context, sourceTokenSource oauth2.TokenSource, d chainDiagnosis, w io.Writer) error {
+	caller := orDefault(d.Caller, "source credential")
+	callerTokenSource := sourceTokenSource
+	for i, serviceAccount := range d.Chain {
+		isTarget := i == len(d.Chain)-1
+		delegates := d.Chain[:i]
+
+		// Intermediate hops are probed by access token to be used as caller of the next testIamPermissions.
+		kind := kindAccessToken
+		if isTarget {
+			kind = d.Kind
+		}
+		required := []string{requiredPermission(kind)}
+		if !isTarget {
+			required = append(required, permissionImplicitDelegation)
+		}
+
+		fmt.Fprintf(w, "hop %d: %s -> %s\n", i+1, caller, serviceAccount)
+		if d.TestIamPermissions && callerTokenSource != nil {
+			granted, err := testServiceAccountPermissions(ctx, callerTokenSource, serviceAccount, tokenCreatorPermissions)
+			if err != nil {
+				fmt.Fprintf(w, "  testIamPermissions: error: %v\n", err)
+			} else {
+				fmt.Fprintf(w, "  testIamPermissions: granted %v, missing %v\n", granted, subtract(required, granted))
+			}
+		}
+
+		token, err := probeImpersonate(ctx, sourceTokenSource, serviceAccount, delegates, kind, d.Audience)
+		if err != nil {
+			fmt.Fprintf(w, "  FAILED: %v\n", err)
+			return fmt.Errorf("impersonation failed at %s -> %s: %s", caller, serviceAccount, describeImpersonateError(err, required))
+		}
+		fmt.Fprintf(w, "  OK\n")
+
+		caller = serviceAccount
+		callerTokenSource = nil
+		if token != "" {
+			callerTokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+		}
+	}
+	return nil
+}
+
+// probeImpersonate issues the token of serviceAccount through delegates.
+// It returns access token only if kind is kindAccessToken.
+func probeImpersonate(ctx context.Context, sourceTokenSource oauth2.TokenSource, serviceAccount string, delegates []string, kind tokenKind, audience string) (string, error) {
+	switch kind {
+	case kindIDToken:
+		_, err := impersonateIdToken(ctx, sourceTokenSource, serviceAccount, delegates, orDefault(audience, "https://example.com"), false)
+		return "", err
+	case kindJWT:
+		_, err := impersonateJWT(ctx, sourceTokenSource, serviceAccount, delegates, jwtClaims(serviceAccount, jwtOption{}))
+		return "", err
+	default:
+		token, err := impersonateAccessToken(ctx, sourceTokenSource, serviceAccount, delegates, defaultScopes, 0)
+		if err != nil {
+			return "", err
+		}
+		return token.AccessToken, nil
+	}
+}
+
+func describeImpersonateError(err error, required []string) string {
+	gerr, ok := err.(*googleapi.Error)
+	if !ok {
+		return err.Error()
+	}
+	switch gerr.Code {
+	case http.StatusForbidden:
+		for _, p := range required {
+			if strings.Contains(gerr.Message, p) {
+				return "missing permission " + p
+			}
+		}
+		return fmt.Sprintf("missing one of permissions %v (roles/iam.serviceAccountTokenCreator): %s", required, gerr.Message)
+	case http.StatusNotFound:
+		return "service account not found: " + gerr.Message
+	default:
+		return err.Error()
+	}
+}
+
+// subtract returns elements of ss which are not contained in other.
+func subtract(ss []string, other []string) []string {
+	var result []string
+	for _, s := range ss {
+		if !contains(other, s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
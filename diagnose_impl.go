@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/iam/v1"
+	"google.golang.org/api/option"
+)
+
+func testServiceAccountPermissions(ctx context.Context, tokenSource oauth2.TokenSource, serviceAccount string, permissions []string) ([]string, error) {
+	service, err := iam.NewService(ctx, option.WithTokenSource(tokenSource))
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := service.Projects.ServiceAccounts.TestIamPermissions(toName(serviceAccount),
+		&iam.TestIamPermissionsRequest{
+			Permissions: permissions,
+		}).Do()
+	if err != nil {
+		return nil, err
+	}
+	return response.Permissions, nil
+}
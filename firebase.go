@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	firebaseCustomTokenAudience       = "https://identitytoolkit.googleapis.com/google.identity.identitytoolkit.v1.IdentityToolkit"
+	defaultIdentityToolkitEndpoint    = "https://identitytoolkit.googleapis.com"
+	firebaseAuthEmulatorHostEnv       = "FIREBASE_AUTH_EMULATOR_HOST"
+	emulatorIdentityToolkitPathPrefix = "/identitytoolkit.googleapis.com"
+)
+
+// firebaseReservedClaims can't be used as developer claims of custom token.
+var firebaseReservedClaims = []string{
+	"acr", "amr", "at_hash", "aud", "auth_time", "azp", "cnf", "c_hash",
+	"exp", "firebase", "iat", "iss", "jti", "nbf", "nonce", "sub",
+}
+
+// firebaseOption configures Firebase custom token and its exchange.
+type firebaseOption struct {
+	UID string
+	// Claims are developer claims which appear in the Firebase ID token.
+	Claims   map[string]interface{}
+	TenantID string
+	APIKey   string
+	// Endpoint is the base URL of Identity Toolkit API.
+	// Empty means FIREBASE_AUTH_EMULATOR_HOST if set, otherwise the production endpoint.
+	Endpoint string
+}
+
+func (opt firebaseOption) endpoint() string {
+	if opt.Endpoint != "" {
+		return opt.Endpoint
+	}
+	if host := os.Getenv(firebaseAuthEmulatorHostEnv); host != "" {
+		return "http://" + host + emulatorIdentityToolkitPathPrefix
+	}
+	return defaultIdentityToolkitEndpoint
+}
+
+// customTokenOption returns claims of Firebase custom token.
+func (opt firebaseOption) customTokenOption() (jwtOption, error) {
+	if opt.UID == "" {
+		return jwtOption{}, errors.New("uid is required for Firebase custom token")
+	}
+	claims := map[string]interface{}{"uid": opt.UID}
+	if len(opt.Claims) > 0 {
+		for k := range opt.Claims {
+			if contains(firebaseReservedClaims, k) {
+				return jwtOption{}, fmt.Errorf("claim %s is reserved in Firebase custom token", k)
+			}
+		}
+		claims["claims"] = opt.Claims
+	}
+	if opt.TenantID != "" {
+		claims["tenant_id"] = opt.TenantID
+	}
+	return jwtOption{
+		Audiences: []string{firebaseCustomTokenAudience},
+		Claims:    claims,
+	}, nil
+}
+
+// FirebaseIDToken mints a Firebase custom token signed by tokenSource
+// and exchanges it to a Firebase ID token.
+func FirebaseIDToken(ctx context.Context, tokenSource TokenSource, opt firebaseOption, sourceScopes ...string) (string, error) {
+	jwtOpt, err := opt.customTokenOption()
+	if err != nil {
+		return "", err
+	}
+	customToken, err := JWTToken(ctx, tokenSource, jwtOpt, sourceScopes...)
+	if err != nil {
+		return "", err
+	}
+	return signInWithCustomToken(ctx, opt, customToken)
+}
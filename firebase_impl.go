@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func signInWithCustomToken(ctx context.Context, opt firebaseOption, customToken string) (string, error) {
+	params := map[string]interface{}{
+		"token":             customToken,
+		"returnSecureToken": true,
+	}
+	if opt.TenantID != "" {
+		params["tenantId"] = opt.TenantID
+	}
+	reqBody, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := strings.TrimSuffix(opt.endpoint(), "/") + "/v1/accounts:signInWithCustomToken"
+	if opt.APIKey != "" {
+		endpoint += "?key=" + url.QueryEscape(opt.APIKey)
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(reqBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if c := resp.StatusCode; c < 200 || c > 299 {
+		return "", fmt.Errorf("signInWithCustomToken failed: %s: %s", resp.Status, body)
+	}
+
+	var res struct {
+		IDToken string `json:"idToken"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", fmt.Errorf("invalid signInWithCustomToken response: %v", err)
+	}
+	return res.IDToken, nil
+}
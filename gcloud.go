@@ -2,28 +2,54 @@ package main
 
 import (
 	"context"
+	"strings"
+	"time"
 )
 
 type gcloudTokenSource struct {
 	cfg *gcloudConfig
 }
 
+// gcloudOption corresponds to flags of gcloud config config-helper.
+type gcloudOption struct {
+	Account string
+	// Configuration is the name of gcloud configuration. Empty means the active configuration.
+	Configuration string
+	ForceRefresh  bool
+	// NoImpersonation ignores auth/impersonate_service_account property.
+	NoImpersonation bool
+}
+
 type gcloudConfig struct {
 	Credential struct {
 		AccessToken string `json:"access_token"`
 		IdToken     string `json:"id_token"`
+		TokenExpiry string `json:"token_expiry"`
 	} `json:"credential"`
 	Configuration struct {
-		Properties struct {
+		ActiveConfiguration string `json:"active_configuration"`
+		Properties          struct {
 			Core struct {
 				Account string `json:"account"`
+				Project string `json:"project"`
 			} `json:"core"`
+			Auth struct {
+				// ImpersonateServiceAccount is a comma separated delegate chain.
+				ImpersonateServiceAccount string `json:"impersonate_service_account"`
+			} `json:"auth"`
 		} `json:"properties"`
 	} `json:"configuration"`
+
+	// impersonated is true if Credential is already impersonated by gcloud config config-helper.
+	impersonated bool
 }
 
 func GcloudTokenSource(account string) (TokenSource, error) {
-	cfg, err := fetchGcloudConfig(account)
+	return GcloudTokenSourceWithOption(gcloudOption{Account: account})
+}
+
+func GcloudTokenSourceWithOption(opt gcloudOption) (TokenSource, error) {
+	cfg, err := fetchGcloudConfig(opt)
 	if err != nil {
 		return nil, err
 	}
@@ -32,9 +58,39 @@ func GcloudTokenSource(account string) (TokenSource, error) {
 }
 
 func (gts *gcloudTokenSource) Email() (string, error) {
+	if gts.cfg.impersonated {
+		return lastOrEmpty(gts.cfg.impersonateChain()), nil
+	}
 	return gts.cfg.Configuration.Properties.Core.Account, nil
 }
 
+func (gts *gcloudTokenSource) Project() (string, error) {
+	return gts.cfg.Configuration.Properties.Core.Project, nil
+}
+
+func (gts *gcloudTokenSource) Expiry() (time.Time, error) {
+	return time.Parse(time.RFC3339, gts.cfg.Credential.TokenExpiry)
+}
+
+// ImpersonateServiceAccounts returns the delegate chain of auth/impersonate_service_account property
+// which the caller should impersonate. It is empty if the token is already impersonated by gcloud.
+func (gts *gcloudTokenSource) ImpersonateServiceAccounts() []string {
+	if gts.cfg.impersonated {
+		return nil
+	}
+	return gts.cfg.impersonateChain()
+}
+
+func (cfg *gcloudConfig) impersonateChain() []string {
+	var chain []string
+	for _, s := range strings.Split(cfg.Configuration.Properties.Auth.ImpersonateServiceAccount, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			chain = append(chain, s)
+		}
+	}
+	return chain
+}
+
 func (gts *gcloudTokenSource) AccessTokenWithoutScopes(ctx context.Context) (string, error) {
 	return gts.cfg.Credential.AccessToken, nil
 }
@@ -2,18 +2,40 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"log"
+	"os"
 	"os/exec"
 )
 
-func fetchGcloudConfig(account string) (*gcloudConfig, error) {
+func fetchGcloudConfig(opt gcloudOption) (*gcloudConfig, error) {
+	cfg, err := fetchGcloudConfigNative(context.Background(), opt)
+	if err == nil {
+		return cfg, nil
+	}
+	log.Println("fallback to gcloud config config-helper:", err)
+	return fetchGcloudConfigHelper(opt)
+}
+
+func fetchGcloudConfigHelper(opt gcloudOption) (*gcloudConfig, error) {
 	var buf bytes.Buffer
 	args := []string{"config", "config-helper", "--format=json"}
-	if account != "" {
-		args = append(args, "--account="+account)
+	if opt.Account != "" {
+		args = append(args, "--account="+opt.Account)
+	}
+	if opt.Configuration != "" {
+		args = append(args, "--configuration="+opt.Configuration)
+	}
+	if opt.ForceRefresh {
+		args = append(args, "--force-auth-refresh")
 	}
 
 	cmd := exec.Command("gcloud", args...)
+	if opt.NoImpersonation {
+		// empty property disables impersonation of this invocation
+		cmd.Env = append(os.Environ(), "CLOUDSDK_AUTH_IMPERSONATE_SERVICE_ACCOUNT=")
+	}
 	cmd.Stdout = &buf
 	err := cmd.Run()
 	if err != nil {
@@ -25,5 +47,7 @@ func fetchGcloudConfig(account string) (*gcloudConfig, error) {
 	if err != nil {
 		return nil, err
 	}
+	// gcloud loads credential with auth/impersonate_service_account, so the token is already impersonated.
+	parsed.impersonated = !opt.NoImpersonation && len(parsed.impersonateChain()) > 0
 	return &parsed, nil
 }
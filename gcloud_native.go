@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// gcloudTokenExpiryLayout is the format of token_expiry column in access_tokens.db.
+const gcloudTokenExpiryLayout = "2006-01-02 15:04:05.999999"
+
+// gcloudTokenExpiryMargin is the margin to avoid using cached token which will expire soon.
+const gcloudTokenExpiryMargin = 5 * time.Minute
+
+func gcloudConfigDir() string {
+	if dir := os.Getenv("CLOUDSDK_CONFIG"); dir != "" {
+		return dir
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("APPDATA"), "gcloud")
+	}
+	return filepath.Join(guessUnixHomeDir(), ".config", "gcloud")
+}
+
+// gcloudActiveConfigName returns the active configuration name in the same precedence as gcloud.
+func gcloudActiveConfigName(dir string) string {
+	if name := os.Getenv("CLOUDSDK_ACTIVE_CONFIG_NAME"); name != "" {
+		return name
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "active_config"))
+	if err != nil {
+		return "default"
+	}
+	return orDefault(strings.TrimSpace(string(b)), "default")
+}
+
+// gcloudProperties is properties of gcloud configuration keyed by section/name.
+type gcloudProperties map[string]string
+
+// readGcloudProperties reads installation properties and named configuration.
+// Properties are overridden by CLOUDSDK_SECTION_NAME environment variables like gcloud.
+func readGcloudProperties(dir string, configName string) (gcloudProperties, error) {
+	props := make(gcloudProperties)
+	for _, filename := range []string{
+		filepath.Join(dir, "properties"),
+		filepath.Join(dir, "configurations", "config_"+configName),
+	} {
+		err := readINI(filename, props)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return props, nil
+}
+
+func (p gcloudProperties) get(key string) string {
+	env := "CLOUDSDK_" + strings.ToUpper(strings.Replace(key, "/", "_", -1))
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	return p[key]
+}
+
+func readINI(filename string, props gcloudProperties) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var section string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "", strings.HasPrefix(line, "#"), strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.TrimSpace(line[1 : len(line)-1])
+		default:
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			props[section+"/"+strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return scanner.Err()
+}
+
+// fetchGcloudConfigNative reads gcloud configuration directory without gcloud command.
+// Expired access token is refreshed using the stored credential.
+func fetchGcloudConfigNative(ctx context.Context, opt gcloudOption) (*gcloudConfig, error) {
+	dir := gcloudConfigDir()
+	configName := orDefault(opt.Configuration, gcloudActiveConfigName(dir))
+	props, err := readGcloudProperties(dir, configName)
+	if err != nil {
+		return nil, err
+	}
+	account := orDefault(opt.Account, props.get("core/account"))
+	if account == "" {
+		return nil, errors.New("gcloud account is not set")
+	}
+
+	var cfg gcloudConfig
+	cfg.Configuration.ActiveConfiguration = configName
+	cfg.Configuration.Properties.Core.Account = account
+	cfg.Configuration.Properties.Core.Project = props.get("core/project")
+	if !opt.NoImpersonation {
+		cfg.Configuration.Properties.Auth.ImpersonateServiceAccount = props.get("auth/impersonate_service_account")
+	}
+
+	if token, idToken, err := readGcloudAccessToken(dir, account); err == nil && token.Valid() && !opt.ForceRefresh {
+		cfg.Credential.AccessToken = token.AccessToken
+		cfg.Credential.IdToken = idToken
+		cfg.Credential.TokenExpiry = token.Expiry.Add(gcloudTokenExpiryMargin).Format(time.RFC3339)
+		return &cfg, nil
+	}
+
+	credential, err := readGcloudCredential(dir, account)
+	if err != nil {
+		return nil, err
+	}
+	token, err := refreshGcloudCredential(ctx, credential)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Credential.AccessToken = token.AccessToken
+	cfg.Credential.TokenExpiry = token.Expiry.UTC().Format(time.RFC3339)
+	if idToken, ok := token.Extra("id_token").(string); ok {
+		cfg.Credential.IdToken = idToken
+	}
+	return &cfg, nil
+}
+
+func readGcloudAccessToken(dir string, account string) (*oauth2.Token, string, error) {
+	db, err := openSQLite(filepath.Join(dir, "access_tokens.db"))
+	if err != nil {
+		return nil, "", err
+	}
+	rows, err := db.readTable("access_tokens")
+	if err != nil {
+		return nil, "", err
+	}
+	for _, row := range rows {
+		if row["account_id"] != account {
+			continue
+		}
+		accessToken, _ := row["access_token"].(string)
+		expiry, _ := row["token_expiry"].(string)
+		idToken, _ := row["id_token"].(string)
+		t, err := time.Parse(gcloudTokenExpiryLayout, expiry)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid token_expiry: %v", err)
+		}
+		return &oauth2.Token{AccessToken: accessToken, Expiry: t.Add(-gcloudTokenExpiryMargin)}, idToken, nil
+	}
+	return nil, "", fmt.Errorf("access token of %s is not found", account)
+}
+
+func readGcloudCredential(dir string, account string) ([]byte, error) {
+	db, err := openSQLite(filepath.Join(dir, "credentials.db"))
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.readTable("credentials")
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row["account_id"] != account {
+			continue
+		}
+		switch v := row["value"].(type) {
+		case string:
+			return []byte(v), nil
+		case []byte:
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("credential of %s is not found", account)
+}
+
+func refreshGcloudCredential(ctx context.Context, credential []byte) (*oauth2.Token, error) {
+	var f struct {
+		Type         string `json:"type"`
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(credential, &f); err != nil {
+		return nil, err
+	}
+	switch f.Type {
+	case "authorized_user":
+		cfg := &oauth2.Config{
+			ClientID:     f.ClientID,
+			ClientSecret: f.ClientSecret,
+			Endpoint:     google.Endpoint,
+		}
+		return cfg.TokenSource(ctx, &oauth2.Token{RefreshToken: f.RefreshToken}).Token()
+	case "service_account":
+		cfg, err := google.JWTConfigFromJSON(credential, defaultScopes...)
+		if err != nil {
+			return nil, err
+		}
+		return cfg.TokenSource(ctx).Token()
+	default:
+		return nil, fmt.Errorf("unsupported gcloud credential type: %s", f.Type)
+	}
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"time"
 
 	"golang.org/x/oauth2"
 )
@@ -10,26 +13,62 @@ type impersonateTokenSource struct {
 	sourceTokenSource oauth2.TokenSource
 	serviceAccount    string
 	delegateChain     []string
+	opt               impersonateOption
+
+	mu     sync.Mutex
+	expiry time.Time
+}
+
+// impersonateOption is passed through to iamcredentials.
+type impersonateOption struct {
+	// Lifetime of access token. Zero means the server default(1h).
+	Lifetime time.Duration
+	// IncludeEmail controls email and email_verified claims of ID token.
+	IncludeEmail bool
 }
 
+var defaultImpersonateOption = impersonateOption{IncludeEmail: true}
+
 func ImpersonateTokenSource(sourceTokenSource oauth2.TokenSource, serviceAccount string, delegateChain ...string) *impersonateTokenSource {
+	return ImpersonateTokenSourceWithOption(sourceTokenSource, defaultImpersonateOption, serviceAccount, delegateChain...)
+}
+
+func ImpersonateTokenSourceWithOption(sourceTokenSource oauth2.TokenSource, opt impersonateOption, serviceAccount string, delegateChain ...string) *impersonateTokenSource {
 	return &impersonateTokenSource{
 		sourceTokenSource: sourceTokenSource,
 		serviceAccount:    serviceAccount,
 		delegateChain:     delegateChain,
+		opt:               opt,
 	}
 }
 
 func (its *impersonateTokenSource) IDToken(ctx context.Context, audience string) (string, error) {
-	return impersonateIdToken(ctx, its.sourceTokenSource, its.serviceAccount, its.delegateChain, audience)
+	return impersonateIdToken(ctx, its.sourceTokenSource, its.serviceAccount, its.delegateChain, audience, its.opt.IncludeEmail)
 }
 
 func (its *impersonateTokenSource) AccessToken(ctx context.Context, scopes ...string) (string, error) {
-	return impersonateAccessToken(ctx, its.sourceTokenSource, its.serviceAccount, its.delegateChain, scopes)
+	token, err := impersonateAccessToken(ctx, its.sourceTokenSource, its.serviceAccount, its.delegateChain, scopes, its.opt.Lifetime)
+	if err != nil {
+		return "", err
+	}
+	its.mu.Lock()
+	its.expiry = token.Expiry
+	its.mu.Unlock()
+	return token.AccessToken, nil
+}
+
+// Expiry returns expiry of the last issued access token.
+func (its *impersonateTokenSource) Expiry() (time.Time, error) {
+	its.mu.Lock()
+	defer its.mu.Unlock()
+	if its.expiry.IsZero() {
+		return time.Time{}, errors.New("no access token is issued")
+	}
+	return its.expiry, nil
 }
 
-func (its *impersonateTokenSource) JWTToken(ctx context.Context, audience string) (string, error) {
-	return impersonateJWT(ctx, its.sourceTokenSource, its.serviceAccount, its.delegateChain, claims(its.serviceAccount, audience, ""))
+func (its *impersonateTokenSource) JWTToken(ctx context.Context, opt jwtOption) (string, error) {
+	return impersonateJWT(ctx, its.sourceTokenSource, its.serviceAccount, its.delegateChain, jwtClaims(its.serviceAccount, opt))
 }
 
 func (its *impersonateTokenSource) Email() (string, error) {
@@ -3,14 +3,25 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iamcredentials/v1"
 	"google.golang.org/api/option"
 )
 
-func impersonateIdToken(ctx context.Context, tokenSource oauth2.TokenSource, serviceAccount string, delegateChain []string, audience string) (string, error) {
+// Lifetime of access token generated by iamcredentials.
+// Lifetime over 1h requires constraints/iam.allowServiceAccountCredentialLifetimeExtension.
+const (
+	defaultImpersonateLifetime = time.Hour
+	maxImpersonateLifetime     = 12 * time.Hour
+)
+
+func impersonateIdToken(ctx context.Context, tokenSource oauth2.TokenSource, serviceAccount string, delegateChain []string, audience string, includeEmail bool) (string, error) {
 	service, err := iamcredentials.NewService(ctx, option.WithTokenSource(tokenSource))
 	if err != nil {
 		return "", err
@@ -21,7 +32,7 @@ func impersonateIdToken(ctx context.Context, tokenSource oauth2.TokenSource, ser
 		&iamcredentials.GenerateIdTokenRequest{
 			Audience:     audience,
 			Delegates:    toNames(delegateChain),
-			IncludeEmail: true,
+			IncludeEmail: includeEmail,
 		}).Do()
 	if err != nil {
 		return "", err
@@ -29,10 +40,13 @@ func impersonateIdToken(ctx context.Context, tokenSource oauth2.TokenSource, ser
 	return response.Token, nil
 }
 
-func impersonateAccessToken(ctx context.Context, tokenSource oauth2.TokenSource, serviceAccount string, delegateChain []string, scopes []string) (string, error) {
+func impersonateAccessToken(ctx context.Context, tokenSource oauth2.TokenSource, serviceAccount string, delegateChain []string, scopes []string, lifetime time.Duration) (*oauth2.Token, error) {
+	if lifetime > maxImpersonateLifetime {
+		return nil, fmt.Errorf("lifetime %v exceeds the maximum %v", lifetime, maxImpersonateLifetime)
+	}
 	service, err := iamcredentials.NewService(ctx, option.WithTokenSource(tokenSource))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	projectsService := iamcredentials.NewProjectsService(service)
 
@@ -40,15 +54,38 @@ func impersonateAccessToken(ctx context.Context, tokenSource oauth2.TokenSource,
 		&iamcredentials.GenerateAccessTokenRequest{
 			Scope:     scopes,
 			Delegates: toNames(delegateChain),
+			Lifetime:  formatLifetime(lifetime),
 		}).Do()
 	if err != nil {
-		return "", err
+		return nil, lifetimeError(err, lifetime)
+	}
+	expiry, err := time.Parse(time.RFC3339, response.ExpireTime)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: response.AccessToken, Expiry: expiry}, nil
+}
+
+func formatLifetime(lifetime time.Duration) string {
+	if lifetime == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%ds", int64(lifetime/time.Second))
+}
+
+// lifetimeError explains the usual cause of rejection of extended lifetime.
+func lifetimeError(err error, lifetime time.Duration) error {
+	if lifetime <= defaultImpersonateLifetime {
+		return err
+	}
+	if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == http.StatusBadRequest {
+		return fmt.Errorf("lifetime %v is not allowed by policy: lifetime over %v needs the service account listed in constraints/iam.allowServiceAccountCredentialLifetimeExtension: %v", lifetime, defaultImpersonateLifetime, err)
 	}
-	return response.AccessToken, nil
+	return err
 }
 
-func impersonateJWTForAudience(ctx context.Context, tokenSource oauth2.TokenSource, serviceAccount string, delegateChain []string, audience string) (string, error) {
-	return impersonateJWT(ctx, tokenSource, serviceAccount, delegateChain, claims(serviceAccount, audience, ""))
+func impersonateJWTWithOption(ctx context.Context, tokenSource oauth2.TokenSource, serviceAccount string, delegateChain []string, opt jwtOption) (string, error) {
+	return impersonateJWT(ctx, tokenSource, serviceAccount, delegateChain, jwtClaims(serviceAccount, opt))
 }
 
 func impersonateJWT(ctx context.Context, tokenSource oauth2.TokenSource, serviceAccount string, delegateChain []string, claims jwt.Claims) (string, error) {
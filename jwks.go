@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	googleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+	// serviceAccountCertsURL serves public x509 certificates of service account keys.
+	serviceAccountCertsURL = "https://www.googleapis.com/service_accounts/v1/metadata/x509/"
+	iapCertsURL            = "https://www.gstatic.com/iap/verify/public_key-jwk"
+	// securetokenCertsURL serves keys of Firebase ID tokens.
+	securetokenCertsURL = "https://www.googleapis.com/service_accounts/v1/jwk/securetoken@system.gserviceaccount.com"
+
+	defaultKeySetMaxAge = time.Hour
+)
+
+// keySet is public keys keyed by key ID.
+type keySet map[string]interface{}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	// X5c is base64 encoded DER certificate chain.
+	X5c []string `json:"x5c,omitempty"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// keySetURL returns URL of the key set described by spec.
+// spec is "google", a service account email or a JWKS URL. Other values are treated as a local file.
+func keySetURL(spec string) (string, bool) {
+	switch {
+	case spec == "google":
+		return googleCertsURL, true
+	case strings.HasPrefix(spec, "https://") || strings.HasPrefix(spec, "http://"):
+		return spec, true
+	case strings.Contains(spec, "@") && !strings.ContainsAny(spec, `/\`):
+		if _, err := os.Stat(spec); os.IsNotExist(err) {
+			return serviceAccountCertsURL + url.PathEscape(spec), true
+		}
+	}
+	return "", false
+}
+
+// keySetCache caches fetched key sets in the cache directory for offline use.
+// Key sets are public, so they are not encrypted.
+type keySetCache struct {
+	dir    string
+	maxAge time.Duration
+	// offline uses cached key sets regardless of age and never fetches.
+	offline bool
+}
+
+func newKeySetCache(maxAge time.Duration, offline bool) *keySetCache {
+	return &keySetCache{dir: filepath.Join(ocurlCacheDir(), "keys"), maxAge: maxAge, offline: offline}
+}
+
+func (kc *keySetCache) file(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return filepath.Join(kc.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// fetch returns the key set of u from cache if it is fresh, otherwise fetches it.
+// Stale cache is used when fetch fails.
+func (kc *keySetCache) fetch(ctx context.Context, u string) ([]byte, error) {
+	filename := kc.file(u)
+	fi, statErr := os.Stat(filename)
+	if statErr == nil && (kc.offline || time.Since(fi.ModTime()) < kc.maxAge) {
+		return ioutil.ReadFile(filename)
+	}
+	if kc.offline {
+		return nil, fmt.Errorf("key set %s is not cached", u)
+	}
+	b, err := fetchKeySet(ctx, u)
+	if err != nil {
+		if statErr == nil {
+			log.Printf("use stale key set cached at %s: %v", fi.ModTime().Format(time.RFC3339), err)
+			return ioutil.ReadFile(filename)
+		}
+		return nil, err
+	}
+	if err := os.MkdirAll(kc.dir, 0700); err != nil {
+		log.Println("key set cache:", err)
+	} else if err := ioutil.WriteFile(filename, b, 0600); err != nil {
+		log.Println("key set cache:", err)
+	}
+	return b, nil
+}
+
+// loadKeySet loads the key set described by spec. See keySetURL.
+// Remote key sets are fetched without cache if cache is nil.
+func loadKeySet(ctx context.Context, spec string, cache *keySetCache) (keySet, error) {
+	if u, ok := keySetURL(spec); ok {
+		if err := checkKeySetURL(u); err != nil {
+			return nil, err
+		}
+		var b []byte
+		var err error
+		if cache != nil {
+			b, err = cache.fetch(ctx, u)
+		} else {
+			b, err = fetchKeySet(ctx, u)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return parseKeySet(b)
+	}
+	b, err := ioutil.ReadFile(spec)
+	if err != nil {
+		return nil, err
+	}
+	return parseKeySet(b)
+}
+
+// checkKeySetURL rejects plain HTTP except loopback hosts for testing because anyone on the path can replace the keys.
+func checkKeySetURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme == "https" {
+		return nil
+	}
+	host := parsed.Hostname()
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return nil
+	}
+	return fmt.Errorf("key set %s must be fetched over https", u)
+}
+
+func fetchKeySet(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch key set %s: %s: %s", u, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return b, nil
+}
+
+// parseKeySet parses JWKS or JSON object of PEM encoded x509 certificates keyed by key ID.
+func parseKeySet(b []byte) (keySet, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(b, &members); err != nil {
+		return nil, fmt.Errorf("invalid key set: %v", err)
+	}
+	if _, ok := members["keys"]; ok {
+		var jwks jsonWebKeySet
+		if err := json.Unmarshal(b, &jwks); err != nil {
+			return nil, fmt.Errorf("invalid JWKS: %v", err)
+		}
+		// keys for encryption and unsupported keys like OKP are skipped so the other keys remain usable
+		keys := make(keySet)
+		for _, jwk := range jwks.Keys {
+			if jwk.Use != "" && jwk.Use != "sig" {
+				continue
+			}
+			key, err := jwk.publicKey()
+			if err != nil {
+				log.Printf("skip key %s: %v", jwk.Kid, err)
+				continue
+			}
+			keys[jwk.Kid] = key
+		}
+		if len(keys) == 0 {
+			return nil, errors.New("JWKS has no usable signing key")
+		}
+		return keys, nil
+	}
+
+	var certs map[string]string
+	if err := json.Unmarshal(b, &certs); err != nil {
+		return nil, errors.New("key set is neither JWKS nor x509 certificates keyed by key ID")
+	}
+	keys := make(keySet)
+	for kid, certPEM := range certs {
+		cert, err := parseCertificate(certPEM)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", kid, err)
+		}
+		keys[kid] = cert.PublicKey
+	}
+	return keys, nil
+}
+
+func parseCertificate(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func (jwk *jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", jwk.Kty)
+	}
+}
+
+// newJSONWebKey converts the public key to JWK for signature verification.
+func newJSONWebKey(kid string, key crypto.PublicKey) (*jsonWebKey, error) {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return &jsonWebKey{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		var alg string
+		switch key.Curve {
+		case elliptic.P256():
+			alg = "ES256"
+		case elliptic.P384():
+			alg = "ES384"
+		case elliptic.P521():
+			alg = "ES512"
+		default:
+			return nil, errors.New("unsupported curve")
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return &jsonWebKey{
+			Kty: "EC",
+			Kid: kid,
+			Use: "sig",
+			Alg: alg,
+			Crv: key.Curve.Params().Name,
+			X:   base64.RawURLEncoding.EncodeToString(padBytes(key.X.Bytes(), size)),
+			Y:   base64.RawURLEncoding.EncodeToString(padBytes(key.Y.Bytes(), size)),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key: %T", key)
+	}
+}
+
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+)
+
+// jwksCommand prints public keys of service accounts as JWKS for verifiers of self-signed JWTs.
+func jwksCommand(args []string) {
+	fs := flag.NewFlagSet("jwks", flag.ExitOnError)
+	var keyFiles, serviceAccounts stringsType
+	fs.Var(&keyFiles, "key-file", "Service Account JSON Key(repeatable, - means stdin)")
+	fs.Var(&serviceAccounts, "service-account", "Service account email to fetch public x509 certificates(repeatable)")
+	_ = fs.Parse(args)
+
+	if len(keyFiles) == 0 && len(serviceAccounts) == 0 {
+		log.Fatalln("--key-file or --service-account is required")
+	}
+
+	var jwks jsonWebKeySet
+	for _, keyFile := range keyFiles {
+		ts, err := KeyFileTokenSourceFromFile(keyFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		kid, key, err := ts.PublicKey()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		jwk, err := newJSONWebKey(kid, key)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		jwks.Keys = append(jwks.Keys, *jwk)
+	}
+
+	ctx := context.Background()
+	for _, sa := range serviceAccounts {
+		keys, err := serviceAccountJSONWebKeys(ctx, sa)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		jwks.Keys = append(jwks.Keys, keys...)
+	}
+
+	b, err := json.MarshalIndent(&jwks, "", "  ")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Println(string(b))
+}
+
+// serviceAccountJSONWebKeys fetches public x509 certificates of the service account keys and converts them to JWKs.
+func serviceAccountJSONWebKeys(ctx context.Context, email string) ([]jsonWebKey, error) {
+	b, err := fetchKeySet(ctx, serviceAccountCertsURL+url.PathEscape(email))
+	if err != nil {
+		return nil, err
+	}
+	var certs map[string]string
+	if err := json.Unmarshal(b, &certs); err != nil {
+		return nil, err
+	}
+	var kids []string
+	for kid := range certs {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	var keys []jsonWebKey
+	for _, kid := range kids {
+		cert, err := parseCertificate(certs[kid])
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", kid, err)
+		}
+		jwk, err := newJSONWebKey(kid, cert.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", kid, err)
+		}
+		jwk.X5c = []string{base64.StdEncoding.EncodeToString(cert.Raw)}
+		keys = append(keys, *jwk)
+	}
+	return keys, nil
+}
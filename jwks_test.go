@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseKeySetSkipsUnusableKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := newJSONWebKey("sig", key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := *sig
+	enc.Kid, enc.Use = "enc", "enc"
+	okp := jsonWebKey{Kty: "OKP", Kid: "okp", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+	secp := jsonWebKey{Kty: "EC", Kid: "secp", Crv: "secp256k1", X: "AA", Y: "AA"}
+
+	b, err := json.Marshal(jsonWebKeySet{Keys: []jsonWebKey{okp, enc, *sig, secp}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := parseKeySet(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := keys["sig"]; !ok || len(keys) != 1 {
+		t.Errorf("parseKeySet() = %v, want only sig", keys)
+	}
+
+	b, err = json.Marshal(jsonWebKeySet{Keys: []jsonWebKey{okp, enc}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := parseKeySet(b); err == nil {
+		t.Errorf("parseKeySet() = %v, want error without usable keys", keys)
+	}
+}
+
+func TestCheckKeySetURL(t *testing.T) {
+	for u, wantOK := range map[string]bool{
+		"https://www.googleapis.com/oauth2/v3/certs": true,
+		"http://127.0.0.1:8080/jwks":                 true,
+		"http://[::1]/jwks":                          true,
+		"http://localhost/jwks":                      true,
+		"http://issuer.example.com/jwks":             false,
+		"http://10.0.0.1/jwks":                       false,
+	} {
+		if err := checkKeySetURL(u); (err == nil) != wantOK {
+			t.Errorf("checkKeySetURL(%s) = %v, want ok %v", u, err, wantOK)
+		}
+	}
+}
+
+func TestLoadKeySetRejectsPlainHTTP(t *testing.T) {
+	// rejected before fetch, so the key set isn't cached or fetched
+	cache := &keySetCache{dir: t.TempDir(), offline: true}
+	if _, err := loadKeySet(context.Background(), "http://issuer.example.com/jwks", cache); err == nil || !strings.Contains(err.Error(), "https") {
+		t.Errorf("loadKeySet() = %v, want https error", err)
+	}
+}
@@ -1,16 +1,36 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
+const defaultJWTLifetime = time.Hour
+
+// jwtOption customizes claims of self-signed JWT.
+type jwtOption struct {
+	Audiences []string
+	Lifetime  time.Duration
+	Claims    map[string]interface{}
+}
+
 func sign(claims jwt.Claims, key interface{}) (string, error) {
 	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
 }
 
+func signWithKeyID(claims jwt.Claims, key interface{}, keyID string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	if keyID != "" {
+		token.Header["kid"] = keyID
+	}
+	return token.SignedString(key)
+}
+
 func claims(account string, audience string, targetAudience string) jwt.Claims {
 	now := time.Now().UTC()
 	claims := jwt.MapClaims{
@@ -26,15 +46,84 @@ func claims(account string, audience string, targetAudience string) jwt.Claims {
 	return claims
 }
 
-func decodeToken(tokenString string) ([]byte, error) {
-	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
+// jwtClaims builds claims of JWT issued by account.
+// Claims in opt override the default claims including iss and sub.
+func jwtClaims(account string, opt jwtOption) jwt.MapClaims {
+	now := time.Now().UTC()
+	lifetime := opt.Lifetime
+	if lifetime == 0 {
+		lifetime = defaultJWTLifetime
+	}
+	claims := jwt.MapClaims{
+		"iss": account,
+		"sub": account,
+		"iat": now.Unix(),
+		"exp": now.Add(lifetime).Unix(),
+	}
+	switch len(opt.Audiences) {
+	case 0:
+	case 1:
+		claims["aud"] = opt.Audiences[0]
+	default:
+		claims["aud"] = opt.Audiences
+	}
+	for k, v := range opt.Claims {
+		claims[k] = v
+	}
+	return claims
+}
+
+func readClaimsFile(filename string) (map[string]interface{}, error) {
+	b, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	b, err := json.MarshalIndent(&token.Claims, "", "  ")
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("invalid claims file %s: %v", filename, err)
+	}
+	return m, nil
+}
+
+// decodedToken is printed by --decode-token.
+type decodedToken struct {
+	Header map[string]interface{} `json:"header"`
+	Claims jwt.MapClaims          `json:"claims"`
+	// Times is human readable timestamp claims.
+	Times  map[string]string `json:"times,omitempty"`
+	Checks []tokenCheck      `json:"checks,omitempty"`
+}
+
+var timestampClaims = []string{"iat", "nbf", "exp", "auth_time"}
+
+// decodeToken decodes tokenString and verifies it if opt is not nil.
+func decodeToken(ctx context.Context, tokenString string, opt *verifyOption) (*decodedToken, error) {
+	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
 	if err != nil {
 		return nil, err
 	}
+	claims := token.Claims.(jwt.MapClaims)
+	decoded := &decodedToken{Header: token.Header, Claims: claims, Times: make(map[string]string)}
+	now := time.Now()
+	for _, name := range timestampClaims {
+		if v, ok := claims[name].(float64); ok {
+			decoded.Times[name] = formatTimestamp(time.Unix(int64(v), 0), now)
+		}
+	}
+	if opt != nil {
+		decoded.Checks, err = verifyToken(ctx, tokenString, claims, *opt, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return decoded, nil
+}
 
-	return b, nil
+// formatTimestamp formats t with the duration from now.
+func formatTimestamp(t time.Time, now time.Time) string {
+	d := t.Sub(now).Truncate(time.Second)
+	if d >= 0 {
+		return fmt.Sprintf("%s (in %s)", t.Format(time.RFC3339), d)
+	}
+	return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC3339), -d)
 }
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	defaultUniverseDomain = "googleapis.com"
+	defaultKeyMaxAge      = 90 * 24 * time.Hour
+)
+
+// keyFileFields is fields of service account JSON key checked by ocurl key check.
+type keyFileFields struct {
+	Type           string `json:"type"`
+	ProjectID      string `json:"project_id"`
+	PrivateKeyID   string `json:"private_key_id"`
+	PrivateKey     string `json:"private_key"`
+	ClientEmail    string `json:"client_email"`
+	TokenURI       string `json:"token_uri"`
+	UniverseDomain string `json:"universe_domain"`
+}
+
+type findingLevel string
+
+const (
+	levelOK    findingLevel = "OK"
+	levelWarn  findingLevel = "WARN"
+	levelError findingLevel = "ERROR"
+)
+
+// keyFinding is a result of ocurl key check.
+type keyFinding struct {
+	Level  findingLevel
+	Name   string
+	Detail string
+}
+
+// googleTokenURIs are token endpoints of googleapis.com universe domain.
+var googleTokenURIs = []string{
+	"https://oauth2.googleapis.com/token",
+	"https://accounts.google.com/o/oauth2/token",
+	tokenURL,
+}
+
+var (
+	privateKeyIDPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	emailPattern        = regexp.MustCompile(`^[^@\s]+@[^@\s]+$`)
+)
+
+func keyCommand(args []string) {
+	if len(args) == 0 || args[0] != "check" {
+		log.Fatalln("usage: ocurl key check [flags] KEY_FILE...")
+	}
+	keyCheckCommand(args[1:])
+}
+
+// keyCheckCommand lints service account JSON keys. It exits with non-zero status if any error is found.
+func keyCheckCommand(args []string) {
+	fs := flag.NewFlagSet("key check", flag.ExitOnError)
+	maxAge := fs.Duration("max-age", defaultKeyMaxAge, "Warn keys older than this duration")
+	offline := fs.Bool("offline", false, "Don't fetch public certificates of the service account")
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		log.Fatalln("usage: ocurl key check [flags] KEY_FILE...")
+	}
+
+	ctx := context.Background()
+	var failed bool
+	for _, keyFile := range fs.Args() {
+		var b []byte
+		var err error
+		if keyFile == "-" {
+			b, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			b, err = ioutil.ReadFile(keyFile)
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+		findings := checkKeyFile(ctx, b, *maxAge, *offline)
+		if fs.NArg() > 1 {
+			fmt.Println(keyFile + ":")
+		}
+		printFindings(os.Stdout, findings)
+		for _, f := range findings {
+			if f.Level == levelError {
+				failed = true
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func checkKeyFile(ctx context.Context, b []byte, maxAge time.Duration, offline bool) []keyFinding {
+	var k keyFileFields
+	if err := json.Unmarshal(b, &k); err != nil {
+		return []keyFinding{{levelError, "json", err.Error()}}
+	}
+
+	var findings []keyFinding
+	add := func(level findingLevel, name, format string, args ...interface{}) {
+		findings = append(findings, keyFinding{level, name, fmt.Sprintf(format, args...)})
+	}
+
+	if k.Type == "service_account" {
+		add(levelOK, "type", "%s", k.Type)
+	} else {
+		add(levelError, "type", "got %q, want \"service_account\"", k.Type)
+	}
+
+	switch {
+	case k.ClientEmail == "":
+		add(levelError, "client_email", "missing")
+	case !emailPattern.MatchString(k.ClientEmail):
+		add(levelError, "client_email", "invalid email: %q", k.ClientEmail)
+	case !strings.HasSuffix(k.ClientEmail, ".gserviceaccount.com"):
+		add(levelWarn, "client_email", "%s is not a service account email", k.ClientEmail)
+	default:
+		add(levelOK, "client_email", "%s", k.ClientEmail)
+	}
+
+	switch {
+	case k.PrivateKeyID == "":
+		add(levelError, "private_key_id", "missing")
+	case !privateKeyIDPattern.MatchString(k.PrivateKeyID):
+		add(levelWarn, "private_key_id", "%q is not 40 hex digits", k.PrivateKeyID)
+	default:
+		add(levelOK, "private_key_id", "%s", k.PrivateKeyID)
+	}
+
+	universeDomain := k.UniverseDomain
+	if universeDomain == "" {
+		add(levelWarn, "universe_domain", "missing, %s is assumed", defaultUniverseDomain)
+		universeDomain = defaultUniverseDomain
+	} else {
+		add(levelOK, "universe_domain", "%s", universeDomain)
+	}
+
+	if u, err := url.Parse(k.TokenURI); k.TokenURI == "" {
+		add(levelError, "token_uri", "missing")
+	} else if err != nil || u.Scheme != "https" {
+		add(levelError, "token_uri", "%q is not https URL", k.TokenURI)
+	} else if universeDomain == defaultUniverseDomain && !contains(googleTokenURIs, k.TokenURI) {
+		add(levelWarn, "token_uri", "%s is not a Google token endpoint", k.TokenURI)
+	} else {
+		add(levelOK, "token_uri", "%s", k.TokenURI)
+	}
+
+	if k.ProjectID == "" {
+		add(levelWarn, "project_id", "missing")
+	}
+
+	publicKey, ok := checkPrivateKey(k.PrivateKey, add)
+	if !ok || k.ClientEmail == "" || k.PrivateKeyID == "" {
+		return findings
+	}
+
+	switch {
+	case offline:
+		add(levelWarn, "certificate", "skipped by --offline")
+	case universeDomain != defaultUniverseDomain:
+		add(levelWarn, "certificate", "skipped for universe domain %s", universeDomain)
+	default:
+		checkCertificate(ctx, k, publicKey, maxAge, add)
+	}
+	return findings
+}
+
+func checkPrivateKey(pemKey string, add func(level findingLevel, name, format string, args ...interface{})) (crypto.PublicKey, bool) {
+	if pemKey == "" {
+		add(levelError, "private_key", "missing")
+		return nil, false
+	}
+	key, err := parsePrivateKey([]byte(pemKey))
+	if err != nil {
+		add(levelError, "private_key", "%v", err)
+		return nil, false
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		add(levelError, "private_key", "%T is not RSA private key", key)
+		return nil, false
+	}
+	if err := rsaKey.Validate(); err != nil {
+		add(levelError, "private_key", "%v", err)
+		return nil, false
+	}
+	if bits := rsaKey.N.BitLen(); bits < 2048 {
+		add(levelWarn, "private_key", "RSA %d bits is weak", bits)
+	} else {
+		add(levelOK, "private_key", "RSA %d bits", bits)
+	}
+	return rsaKey.Public(), true
+}
+
+// checkCertificate checks the public certificate of the key is published and matches the private key.
+// The certificate is valid from the key creation to the key expiration.
+func checkCertificate(ctx context.Context, k keyFileFields, publicKey crypto.PublicKey, maxAge time.Duration, add func(level findingLevel, name, format string, args ...interface{})) {
+	b, err := fetchKeySet(ctx, serviceAccountCertsURL+url.PathEscape(k.ClientEmail))
+	if err != nil {
+		add(levelWarn, "certificate", "certificates are unreachable: %v", err)
+		return
+	}
+	var certs map[string]string
+	if err := json.Unmarshal(b, &certs); err != nil {
+		add(levelWarn, "certificate", "invalid certificates: %v", err)
+		return
+	}
+	certPEM, ok := certs[k.PrivateKeyID]
+	if !ok {
+		add(levelError, "certificate", "key %s is not found, it may be deleted or disabled", k.PrivateKeyID)
+		return
+	}
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		add(levelError, "certificate", "%v", err)
+		return
+	}
+	certKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if rsaKey := publicKey.(*rsa.PublicKey); !ok || certKey.N.Cmp(rsaKey.N) != 0 || certKey.E != rsaKey.E {
+		add(levelError, "certificate", "public key of %s doesn't match private_key", k.PrivateKeyID)
+		return
+	}
+	add(levelOK, "certificate", "public key matches")
+
+	now := time.Now()
+	age := now.Sub(cert.NotBefore)
+	switch {
+	case now.After(cert.NotAfter):
+		add(levelError, "expiry", "key expired at %s", cert.NotAfter.Format(time.RFC3339))
+	case cert.NotAfter.Year() < 9999:
+		add(levelOK, "expiry", "key expires at %s", cert.NotAfter.Format(time.RFC3339))
+	}
+	if age > maxAge {
+		add(levelWarn, "age", "key was created at %s, %d days ago. Consider rotating it", cert.NotBefore.Format(time.RFC3339), int(age.Hours()/24))
+	} else {
+		add(levelOK, "age", "key was created at %s", cert.NotBefore.Format(time.RFC3339))
+	}
+}
+
+func printFindings(w io.Writer, findings []keyFinding) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, f := range findings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Level, f.Name, f.Detail)
+	}
+	tw.Flush()
+}
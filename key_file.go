@@ -2,19 +2,56 @@ package main
 
 import (
 	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"sync"
+	"time"
 
 	"golang.org/x/oauth2/google"
 	"golang.org/x/oauth2/jwt"
 )
 
 type keyFileTokenSource struct {
-	jsonKey []byte
-	cfg     *jwt.Config
+	jsonKey   []byte
+	cfg       *jwt.Config
+	projectID string
+
+	mu     sync.Mutex
+	expiry time.Time
 }
 
+// KeyFileTokenSourceFromFile reads JSON key from keyFile. "-" means stdin.
 func KeyFileTokenSourceFromFile(keyFile string) (*keyFileTokenSource, error) {
-	buf, err := ioutil.ReadFile(keyFile)
+	var buf []byte
+	var err error
+	if keyFile == "-" {
+		buf, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		buf, err = ioutil.ReadFile(keyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return KeyFileTokenSource(buf)
+}
+
+// KeyFileTokenSourceFromEnv reads JSON key content from the environment variable.
+func KeyFileTokenSourceFromEnv(env string) (*keyFileTokenSource, error) {
+	v := os.Getenv(env)
+	if v == "" {
+		return nil, fmt.Errorf("environment variable %s is empty", env)
+	}
+	return KeyFileTokenSource([]byte(v))
+}
+
+// KeyFileTokenSourceFromCommand reads JSON key from stdout of the shell command.
+// It is useful to keep keys in memory using secret manager CLIs.
+func KeyFileTokenSourceFromCommand(command string) (*keyFileTokenSource, error) {
+	buf, err := runKeyCommand(command)
 	if err != nil {
 		return nil, err
 	}
@@ -27,13 +64,37 @@ func KeyFileTokenSource(jsonKey []byte) (*keyFileTokenSource, error) {
 		return nil, err
 	}
 
-	return &keyFileTokenSource{jsonKey: jsonKey, cfg: cfg}, nil
+	var f struct {
+		ProjectID string `json:"project_id"`
+	}
+	if err := json.Unmarshal(jsonKey, &f); err != nil {
+		return nil, err
+	}
+
+	return &keyFileTokenSource{jsonKey: jsonKey, cfg: cfg, projectID: f.ProjectID}, nil
 }
 
 func (kfts *keyFileTokenSource) Email() (string, error) {
 	return kfts.cfg.Email, nil
 }
 
+// PublicKey returns the key ID and the public key of the signing key.
+func (kfts *keyFileTokenSource) PublicKey() (string, crypto.PublicKey, error) {
+	key, err := parsePrivateKey(kfts.cfg.PrivateKey)
+	if err != nil {
+		return "", nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", nil, errors.New("private key can't derive public key")
+	}
+	return kfts.cfg.PrivateKeyID, signer.Public(), nil
+}
+
+func (kfts *keyFileTokenSource) Project() (string, error) {
+	return kfts.projectID, nil
+}
+
 func (kfts *keyFileTokenSource) AccessToken(ctx context.Context, scopes ...string) (string, error) {
 	tokenSource, err := jwtConfigTokenSource(ctx, kfts.jsonKey, scopes...)
 	if err != nil {
@@ -45,9 +106,22 @@ func (kfts *keyFileTokenSource) AccessToken(ctx context.Context, scopes ...strin
 		return "", err
 	}
 
+	kfts.mu.Lock()
+	kfts.expiry = token.Expiry
+	kfts.mu.Unlock()
 	return token.AccessToken, nil
 }
 
+// Expiry returns expiry of the last issued access token.
+func (kfts *keyFileTokenSource) Expiry() (time.Time, error) {
+	kfts.mu.Lock()
+	defer kfts.mu.Unlock()
+	if kfts.expiry.IsZero() {
+		return time.Time{}, errors.New("no access token is issued")
+	}
+	return kfts.expiry, nil
+}
+
 func (kfts *keyFileTokenSource) IDToken(ctx context.Context, audience string) (string, error) {
 	signedJWT, err := signJWTForIdToken(kfts.cfg, audience)
 	if err != nil {
@@ -56,15 +130,6 @@ func (kfts *keyFileTokenSource) IDToken(ctx context.Context, audience string) (s
 	return idTokenImpl(signedJWT)
 }
 
-func (kfts *keyFileTokenSource) JWTToken(ctx context.Context, audience string) (string, error) {
-	ts, err := jwtAccessTokenSource(kfts.jsonKey, audience)
-	if err != nil {
-		return "", err
-	}
-
-	token, err := ts.Token()
-	if err != nil {
-		return "", err
-	}
-	return token.AccessToken, nil
+func (kfts *keyFileTokenSource) JWTToken(ctx context.Context, opt jwtOption) (string, error) {
+	return signJWT(kfts.cfg, opt)
 }
@@ -5,11 +5,15 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -21,11 +25,7 @@ const tokenURL = "https://www.googleapis.com/oauth2/v4/token"
 
 func signJWTForIdToken(cfg *jwt.Config, audience string) (string, error) {
 	claims := claims(cfg.Email, tokenURL, audience)
-	block, _ := pem.Decode(cfg.PrivateKey)
-	if block.Type != "PRIVATE KEY" {
-		return "", fmt.Errorf("unknown key file: %s", block.Type)
-	}
-	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	key, err := parsePrivateKey(cfg.PrivateKey)
 	if err != nil {
 		return "", err
 	}
@@ -33,6 +33,29 @@ func signJWTForIdToken(cfg *jwt.Config, audience string) (string, error) {
 	return sign(claims, key)
 }
 
+func signJWT(cfg *jwt.Config, opt jwtOption) (string, error) {
+	key, err := parsePrivateKey(cfg.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	return signWithKeyID(jwtClaims(cfg.Email, opt), key, cfg.PrivateKeyID)
+}
+
+func parsePrivateKey(pemKey []byte) (interface{}, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unknown key file: %s", block.Type)
+	}
+}
+
 func idTokenImpl(signedJWT string) (string, error) {
 	v := url.Values{}
 	v.Set("grant_type", defaultGrantType)
@@ -63,18 +86,30 @@ func idTokenImpl(signedJWT string) (string, error) {
 
 }
 
-func jwtAccessTokenSource(json []byte, audience string) (oauth2.TokenSource, error) {
-	config, err := google.JWTAccessTokenSourceFromJSON(json, audience)
+func jwtConfigTokenSource(ctx context.Context, json []byte, scopes ...string) (oauth2.TokenSource, error) {
+	config, err := google.JWTConfigFromJSON(json, scopes...)
 	if err != nil {
 		return nil, err
 	}
-	return config, nil
+	return config.TokenSource(ctx), err
 }
 
-func jwtConfigTokenSource(ctx context.Context, json []byte, scopes ...string) (oauth2.TokenSource, error) {
-	config, err := google.JWTConfigFromJSON(json, scopes...)
+func runKeyCommand(command string) ([]byte, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	// stdin is left for curl. Interactive commands can prompt via the terminal.
+	out, err := cmd.Output()
 	if err != nil {
-		return nil, err
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("key command failed: %v: %s", err, msg)
+		}
+		return nil, fmt.Errorf("key command failed: %v", err)
 	}
-	return config.TokenSource(ctx), err
+	return out, nil
 }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+// kmsTokenSource signs JWT by Cloud KMS asymmetric key.
+// The credential of sourceTokenSource is used only to call Cloud KMS.
+type kmsTokenSource struct {
+	sourceTokenSource oauth2.TokenSource
+	keyVersion        string
+	endpoint          string
+	issuer            string
+}
+
+// KMSTokenSource signs JWT by keyVersion in the form of projects/*/locations/*/keyRings/*/cryptoKeys/*/cryptoKeyVersions/*.
+// issuer is used as default iss and sub claims. endpoint overrides Cloud KMS endpoint if it is not empty.
+func KMSTokenSource(sourceTokenSource oauth2.TokenSource, keyVersion string, issuer string, endpoint string) *kmsTokenSource {
+	return &kmsTokenSource{
+		sourceTokenSource: sourceTokenSource,
+		keyVersion:        keyVersion,
+		endpoint:          endpoint,
+		issuer:            issuer,
+	}
+}
+
+func (kts *kmsTokenSource) Email() (string, error) {
+	if kts.issuer == "" {
+		return "", errors.New("issuer of KMS signed JWT is unknown")
+	}
+	return kts.issuer, nil
+}
+
+func (kts *kmsTokenSource) JWTToken(ctx context.Context, opt jwtOption) (string, error) {
+	client, err := newKMSClient(ctx, kts.sourceTokenSource, kts.endpoint)
+	if err != nil {
+		return "", err
+	}
+	algorithm, err := client.algorithm(kts.keyVersion)
+	if err != nil {
+		return "", err
+	}
+	method, err := kmsSigningMethodFor(algorithm)
+	if err != nil {
+		return "", err
+	}
+	method.sign = func(digest []byte) ([]byte, error) {
+		return client.sign(kts.keyVersion, digest)
+	}
+
+	token := jwt.NewWithClaims(method, jwtClaims(kts.issuer, opt))
+	token.Header["kid"] = kts.keyVersion
+	return token.SignedString(nil)
+}
+
+// kmsSigningMethod is a jwt.SigningMethod which delegates signing of SHA-256 digest to Cloud KMS.
+type kmsSigningMethod struct {
+	alg  string
+	ec   bool
+	sign func(digest []byte) ([]byte, error)
+}
+
+// kmsSigningMethodFor maps CryptoKeyVersionAlgorithm to JWS algorithm.
+func kmsSigningMethodFor(algorithm string) (*kmsSigningMethod, error) {
+	switch algorithm {
+	case "RSA_SIGN_PKCS1_2048_SHA256", "RSA_SIGN_PKCS1_3072_SHA256", "RSA_SIGN_PKCS1_4096_SHA256":
+		return &kmsSigningMethod{alg: "RS256"}, nil
+	case "RSA_SIGN_PSS_2048_SHA256", "RSA_SIGN_PSS_3072_SHA256", "RSA_SIGN_PSS_4096_SHA256":
+		return &kmsSigningMethod{alg: "PS256"}, nil
+	case "EC_SIGN_P256_SHA256":
+		return &kmsSigningMethod{alg: "ES256", ec: true}, nil
+	default:
+		return nil, fmt.Errorf("unsupported KMS key algorithm for JWT: %s", algorithm)
+	}
+}
+
+func (m *kmsSigningMethod) Alg() string {
+	return m.alg
+}
+
+func (m *kmsSigningMethod) Verify(signingString, signature string, key interface{}) error {
+	return errors.New("kmsSigningMethod can't verify signature")
+}
+
+func (m *kmsSigningMethod) Sign(signingString string, key interface{}) (string, error) {
+	digest := sha256.Sum256([]byte(signingString))
+	sig, err := m.sign(digest[:])
+	if err != nil {
+		return "", err
+	}
+	if m.ec {
+		sig, err = ecdsaDERToJOSE(sig, 32)
+		if err != nil {
+			return "", err
+		}
+	}
+	return jwt.EncodeSegment(sig), nil
+}
+
+// ecdsaDERToJOSE converts ASN.1 DER ECDSA signature into fixed-length r||s of JWS.
+func ecdsaDERToJOSE(der []byte, size int) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, fmt.Errorf("invalid ECDSA signature: %v", err)
+	}
+	r, s := sig.R.Bytes(), sig.S.Bytes()
+	if len(r) > size || len(s) > size {
+		return nil, errors.New("invalid ECDSA signature length")
+	}
+	jose := make([]byte, 2*size)
+	copy(jose[size-len(r):size], r)
+	copy(jose[2*size-len(s):], s)
+	return jose, nil
+}
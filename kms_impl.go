@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+)
+
+type kmsClient struct {
+	versions *cloudkms.ProjectsLocationsKeyRingsCryptoKeysCryptoKeyVersionsService
+}
+
+func newKMSClient(ctx context.Context, tokenSource oauth2.TokenSource, endpoint string) (*kmsClient, error) {
+	opts := []option.ClientOption{option.WithTokenSource(tokenSource)}
+	if endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+	service, err := cloudkms.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &kmsClient{versions: service.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions}, nil
+}
+
+func (c *kmsClient) algorithm(keyVersion string) (string, error) {
+	publicKey, err := c.versions.GetPublicKey(keyVersion).Do()
+	if err != nil {
+		return "", err
+	}
+	return publicKey.Algorithm, nil
+}
+
+func (c *kmsClient) sign(keyVersion string, digest []byte) ([]byte, error) {
+	response, err := c.versions.AsymmetricSign(keyVersion, &cloudkms.AsymmetricSignRequest{
+		Digest: &cloudkms.Digest{Sha256: base64.StdEncoding.EncodeToString(digest)},
+	}).Do()
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(response.Signature)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+func TestECDSADERToJOSE(t *testing.T) {
+	der := func(r, s *big.Int) []byte {
+		b, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	full := new(big.Int).SetBytes(bytes.Repeat([]byte{0xff}, 32))
+	for _, tt := range []struct {
+		name    string
+		der     []byte
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "full length",
+			der:  der(full, big.NewInt(1)),
+			want: append(bytes.Repeat([]byte{0xff}, 32), append(make([]byte, 31), 1)...),
+		},
+		{
+			// r and s with the high bit set are encoded with a leading zero in DER.
+			name: "leading zero in DER",
+			der:  der(full, full),
+			want: bytes.Repeat([]byte{0xff}, 64),
+		},
+		{
+			name: "short values are left padded",
+			der:  der(big.NewInt(0x0102), big.NewInt(0x03)),
+			want: append(append(make([]byte, 30), 1, 2), append(make([]byte, 31), 3)...),
+		},
+		{
+			name:    "too long",
+			der:     der(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1)),
+			wantErr: true,
+		},
+		{
+			name:    "not DER",
+			der:     []byte("not a signature"),
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ecdsaDERToJOSE(tt.der, 32)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ecdsaDERToJOSE() = %x, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("ecdsaDERToJOSE() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeKMS serves GetPublicKey and AsymmetricSign of Cloud KMS for a single key version signed by key.
+func fakeKMS(t *testing.T, keyVersion, algorithm string, key crypto.Signer) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer source-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/"+keyVersion+"/publicKey":
+			json.NewEncoder(w).Encode(map[string]string{"algorithm": algorithm})
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/"+keyVersion+":asymmetricSign":
+			var req struct {
+				Digest struct {
+					Sha256 string `json:"sha256"`
+				} `json:"digest"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			digest, err := base64.StdEncoding.DecodeString(req.Digest.Sha256)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			var opts crypto.SignerOpts = crypto.SHA256
+			if strings.HasPrefix(algorithm, "RSA_SIGN_PSS_") {
+				opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+			}
+			sig, err := key.Sign(rand.Reader, digest, opts)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"signature": base64.StdEncoding.EncodeToString(sig)})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestKMSTokenSourceJWTToken(t *testing.T) {
+	const keyVersion = "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		algorithm string
+		key       crypto.Signer
+		wantAlg   string
+	}{
+		{algorithm: "RSA_SIGN_PKCS1_2048_SHA256", key: rsaKey, wantAlg: "RS256"},
+		{algorithm: "RSA_SIGN_PSS_2048_SHA256", key: rsaKey, wantAlg: "PS256"},
+		{algorithm: "EC_SIGN_P256_SHA256", key: ecKey, wantAlg: "ES256"},
+	} {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			server := fakeKMS(t, keyVersion, tt.algorithm, tt.key)
+			source := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "source-token"})
+			kts := KMSTokenSource(source, keyVersion, "signer@example.com", server.URL+"/")
+			signed, err := kts.JWTToken(context.Background(), jwtOption{Audiences: []string{"https://example.com"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims := jwt.MapClaims{}
+			token, err := jwt.ParseWithClaims(signed, claims, func(token *jwt.Token) (interface{}, error) {
+				return tt.key.Public(), nil
+			})
+			if err != nil {
+				t.Fatalf("signature of %s doesn't verify: %v", signed, err)
+			}
+			if got := token.Method.Alg(); got != tt.wantAlg {
+				t.Errorf("alg = %s, want %s", got, tt.wantAlg)
+			}
+			if got := token.Header["kid"]; got != keyVersion {
+				t.Errorf("kid = %v, want %s", got, keyVersion)
+			}
+			if claims["iss"] != "signer@example.com" || claims["aud"] != "https://example.com" {
+				t.Errorf("unexpected claims: %v", claims)
+			}
+		})
+	}
+}
+
+func TestKMSSigningMethodForUnsupported(t *testing.T) {
+	for _, algorithm := range []string{"EC_SIGN_P384_SHA384", "RSA_SIGN_PKCS1_4096_SHA512", "GOOGLE_SYMMETRIC_ENCRYPTION"} {
+		if _, err := kmsSigningMethodFor(algorithm); err == nil {
+			t.Errorf("kmsSigningMethodFor(%s) should fail", algorithm)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+var defaultLoginScopes = []string{
+	"openid",
+	"email",
+	"https://www.googleapis.com/auth/cloud-platform",
+}
+
+var defaultOIDCLoginScopes = []string{"openid", "email", "offline_access"}
+
+// loginOption configures OAuth2 client used by ocurl login.
+type loginOption struct {
+	// Issuer is used to discover endpoints of OIDC provider which are not given explicitly.
+	Issuer           string
+	ClientSecretFile string
+	ClientID         string
+	ClientSecret     string
+	AuthURL          string
+	TokenURL         string
+	DeviceAuthURL    string
+	Scopes           []string
+}
+
+// discover fills endpoints which are not given explicitly from OIDC discovery of Issuer.
+func (opt *loginOption) discover(ctx context.Context) error {
+	if opt.Issuer == "" {
+		opt.DeviceAuthURL = orDefault(opt.DeviceAuthURL, googleDeviceAuthURL)
+		return nil
+	}
+	discovery, err := discoverOIDC(ctx, opt.Issuer)
+	if err != nil {
+		return err
+	}
+	opt.AuthURL = orDefault(opt.AuthURL, discovery.AuthorizationEndpoint)
+	opt.TokenURL = orDefault(opt.TokenURL, discovery.TokenEndpoint)
+	opt.DeviceAuthURL = orDefault(opt.DeviceAuthURL, discovery.DeviceAuthorizationEndpoint)
+	return nil
+}
+
+func (opt loginOption) config() (*oauth2.Config, error) {
+	var cfg *oauth2.Config
+	if opt.ClientSecretFile != "" {
+		b, err := ioutil.ReadFile(opt.ClientSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg, err = google.ConfigFromJSON(b, opt.Scopes...)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if opt.ClientID == "" {
+			return nil, fmt.Errorf("--client-secret-file or --client-id is required")
+		}
+		cfg = &oauth2.Config{
+			ClientID:     opt.ClientID,
+			ClientSecret: opt.ClientSecret,
+			Endpoint:     google.Endpoint,
+			Scopes:       opt.Scopes,
+		}
+	}
+	cfg.Endpoint.AuthURL = orDefault(opt.AuthURL, cfg.Endpoint.AuthURL)
+	cfg.Endpoint.TokenURL = orDefault(opt.TokenURL, cfg.Endpoint.TokenURL)
+	return cfg, nil
+}
+
+func loginCommand(args []string) {
+	var opt loginOption
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	fs.StringVar(&opt.Issuer, "issuer", "", "OIDC issuer URL to discover endpoints(default: Google)")
+	fs.StringVar(&opt.ClientSecretFile, "client-secret-file", "", "client_secret.json of OAuth client")
+	fs.StringVar(&opt.ClientID, "client-id", "", "OAuth client ID")
+	fs.StringVar(&opt.ClientSecret, "client-secret", "", "OAuth client secret")
+	fs.StringVar(&opt.AuthURL, "auth-url", "", "Authorization endpoint(default: Google)")
+	fs.StringVar(&opt.TokenURL, "token-url", "", "Token endpoint(default: Google)")
+	fs.StringVar(&opt.DeviceAuthURL, "device-auth-url", "", "Device authorization endpoint(default: Google)")
+	var rawScopes stringsType
+	fs.Var(&rawScopes, "scopes", "Scopes(default openid,email,cloud-platform for Google, openid,email for Google with --device)")
+	credentialName := fs.String("name", defaultCredentialName, "Name of stored credential")
+	noBrowser := fs.Bool("no-browser", false, "Don't open browser, only print authorization URL")
+	device := fs.Bool("device", false, "Use device authorization grant for headless machines")
+	_ = fs.Parse(args)
+
+	if err := validateCredentialName(*credentialName); err != nil {
+		log.Fatalln(err)
+	}
+
+	// scopes of other providers are not prefixed
+	switch {
+	case opt.Issuer != "":
+		opt.Scopes = rawScopes
+		if len(opt.Scopes) == 0 {
+			opt.Scopes = defaultOIDCLoginScopes
+		}
+	default:
+		opt.Scopes = normalizeScopes(rawScopes)
+		switch {
+		case len(opt.Scopes) == 0 && *device:
+			opt.Scopes = defaultDeviceLoginScopes
+		case len(opt.Scopes) == 0:
+			opt.Scopes = defaultLoginScopes
+		}
+		if *device && opt.DeviceAuthURL == "" {
+			if err := checkGoogleDeviceScopes(opt.Scopes); err != nil {
+				log.Fatalln(err)
+			}
+		}
+	}
+	if err := opt.discover(context.Background()); err != nil {
+		log.Fatalln(err)
+	}
+	cfg, err := opt.config()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var token *oauth2.Token
+	if *device {
+		token, err = deviceLogin(context.Background(), cfg, opt.DeviceAuthURL, os.Stderr)
+	} else {
+		var open func(string) error
+		if !*noBrowser {
+			open = openBrowser
+		}
+		token, err = loopbackLogin(context.Background(), cfg, open, os.Stderr)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := saveLoginToken(*credentialName, cfg, token); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// saveLoginToken stores the refresh token of the login result as named credential.
+func saveLoginToken(name string, cfg *oauth2.Config, token *oauth2.Token) error {
+	if token.RefreshToken == "" {
+		return fmt.Errorf("token response has no refresh token")
+	}
+	cred := &storedCredential{
+		Type:         "authorized_user",
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RefreshToken: token.RefreshToken,
+		TokenURI:     cfg.Endpoint.TokenURL,
+		Scopes:       cfg.Scopes,
+		Account:      tokenEmail(token),
+	}
+	if err := saveCredential(name, cred); err != nil {
+		return err
+	}
+	log.Printf("Saved credential %s(account: %s) to %s", name, orDefault(cred.Account, "unknown"), credentialFile(name))
+	return nil
+}
+
+// tokenEmail returns email claim of id_token in the token response.
+// The ID token isn't verified because it is received directly from the token endpoint.
+func tokenEmail(token *oauth2.Token) string {
+	idToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return ""
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(idToken, claims); err != nil {
+		return ""
+	}
+	email, _ := claims["email"].(string)
+	return email
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"runtime"
+
+	"golang.org/x/oauth2"
+)
+
+// pkce is a code verifier and its S256 challenge of RFC 7636.
+type pkce struct {
+	verifier  string
+	challenge string
+}
+
+func newPKCE() (*pkce, error) {
+	verifier, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return &pkce{
+		verifier:  verifier,
+		challenge: base64.RawURLEncoding.EncodeToString(sum[:]),
+	}, nil
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type loopbackResult struct {
+	code string
+	err  error
+}
+
+// loopbackLogin runs authorization code flow with PKCE using loopback redirect.
+// The authorization URL is printed to w and passed to open if it is not nil.
+func loopbackLogin(ctx context.Context, cfg *oauth2.Config, open func(string) error, w io.Writer) (*oauth2.Token, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	state, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+	p, err := newPKCE()
+	if err != nil {
+		return nil, err
+	}
+
+	loopbackCfg := *cfg
+	loopbackCfg.RedirectURL = fmt.Sprintf("http://%s/", listener.Addr())
+
+	resultCh := make(chan loopbackResult, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		// ignore stray requests like favicon.ico and preconnect of browsers
+		if q.Get("code") == "" && q.Get("error") == "" {
+			http.NotFound(rw, r)
+			return
+		}
+		var result loopbackResult
+		switch {
+		case q.Get("state") != state:
+			result.err = errors.New("state mismatch")
+		case q.Get("error") != "":
+			result.err = fmt.Errorf("authorization failed: %s %s", q.Get("error"), q.Get("error_description"))
+		default:
+			result.code = q.Get("code")
+		}
+		if result.err != nil {
+			http.Error(rw, result.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(rw, "Authorized. You can close this window.")
+		}
+		select {
+		case resultCh <- result:
+		default:
+		}
+	})}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	authURL := loopbackCfg.AuthCodeURL(state,
+		oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("code_challenge", p.challenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+	fmt.Fprintf(w, "Open the following URL in your browser:\n\n    %s\n\n", authURL)
+	if open != nil {
+		if err := open(authURL); err != nil {
+			fmt.Fprintln(w, "Can't open browser:", err)
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-resultCh:
+		if result.err != nil {
+			return nil, result.err
+		}
+		return loopbackCfg.Exchange(ctx, result.code, oauth2.SetAuthURLParam("code_verifier", p.verifier))
+	}
+}
+
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	case "darwin":
+		return exec.Command("open", url).Start()
+	default:
+		return exec.Command("xdg-open", url).Start()
+	}
+}
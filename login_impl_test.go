@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestNewPKCE(t *testing.T) {
+	p, err := newPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RFC 7636 requires 43 to 128 characters
+	if len(p.verifier) < 43 || len(p.verifier) > 128 {
+		t.Errorf("verifier length %d", len(p.verifier))
+	}
+	sum := sha256.Sum256([]byte(p.verifier))
+	if want := base64.RawURLEncoding.EncodeToString(sum[:]); p.challenge != want {
+		t.Errorf("challenge: got %s, want %s", p.challenge, want)
+	}
+}
+
+func TestLoopbackLogin(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		// callback returns the query of the redirect from the authorization server
+		callback func(state string) url.Values
+		wantErr  string
+	}{
+		{
+			name: "success",
+			callback: func(state string) url.Values {
+				return url.Values{"code": {"good-code"}, "state": {state}}
+			},
+		},
+		{
+			name: "state mismatch",
+			callback: func(state string) url.Values {
+				return url.Values{"code": {"good-code"}, "state": {"forged"}}
+			},
+			wantErr: "state mismatch",
+		},
+		{
+			name: "denied",
+			callback: func(state string) url.Values {
+				return url.Values{"error": {"access_denied"}, "state": {state}}
+			},
+			wantErr: "access_denied",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var challenge, redirectURI string
+			tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Error(err)
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+				switch {
+				case r.PostForm.Get("grant_type") != "authorization_code":
+					t.Errorf("grant_type: %s", r.PostForm.Get("grant_type"))
+				case r.PostForm.Get("code") != "good-code":
+					t.Errorf("code: %s", r.PostForm.Get("code"))
+				case base64.RawURLEncoding.EncodeToString(sum[:]) != challenge:
+					t.Error("code_verifier doesn't match code_challenge")
+				case r.PostForm.Get("redirect_uri") != redirectURI:
+					t.Errorf("redirect_uri: %s", r.PostForm.Get("redirect_uri"))
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "at", "refresh_token": "rt", "token_type": "Bearer", "expires_in": 3600})
+			}))
+			defer tokenServer.Close()
+
+			cfg := &oauth2.Config{
+				ClientID: "client",
+				Endpoint: oauth2.Endpoint{AuthURL: "https://auth.example.com/auth", TokenURL: tokenServer.URL},
+			}
+			// open acts as the browser and the authorization server
+			open := func(authURL string) error {
+				u, err := url.Parse(authURL)
+				if err != nil {
+					return err
+				}
+				q := u.Query()
+				if q.Get("code_challenge_method") != "S256" {
+					t.Errorf("code_challenge_method: %s", q.Get("code_challenge_method"))
+				}
+				challenge = q.Get("code_challenge")
+				redirectURI = q.Get("redirect_uri")
+
+				// stray requests must not abort the login
+				for _, path := range []string{"favicon.ico", ""} {
+					resp, err := http.Get(redirectURI + path)
+					if err != nil {
+						return err
+					}
+					resp.Body.Close()
+					if resp.StatusCode != http.StatusNotFound {
+						t.Errorf("stray request /%s: %s", path, resp.Status)
+					}
+				}
+
+				resp, err := http.Get(redirectURI + "?" + tt.callback(q.Get("state")).Encode())
+				if err != nil {
+					return err
+				}
+				defer resp.Body.Close()
+				_, err = ioutil.ReadAll(resp.Body)
+				return err
+			}
+
+			token, err := loopbackLogin(context.Background(), cfg, open, ioutil.Discard)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("want error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.AccessToken != "at" || token.RefreshToken != "rt" {
+				t.Errorf("unexpected token: %+v", token)
+			}
+		})
+	}
+}
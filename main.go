@@ -2,14 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"golang.org/x/oauth2"
 )
@@ -19,6 +20,11 @@ var defaultScopes = []string{
 	"https://www.googleapis.com/auth/userinfo.email",
 }
 
+// defaultSourceScopes is the minimal scopes of source credential to call iamcredentials.
+var defaultSourceScopes = []string{
+	"https://www.googleapis.com/auth/iam",
+}
+
 const scopePrefix = "https://www.googleapis.com/auth/"
 
 func toName(serviceAccount string) string {
@@ -33,30 +39,104 @@ func toNames(serviceAccounts []string) []string {
 	return slice
 }
 
+// subcommands are dispatched by the first argument before flag parsing.
+var subcommands = map[string]func(args []string){
+	"login":  loginCommand,
+	"cache":  cacheCommand,
+	"jwks":   jwksCommand,
+	"key":    keyCommand,
+	"verify": verifyCommand,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := subcommands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+
 	// token types
 	var accessTokenFlag = flag.Bool("access-token", false, "Use access token")
 	var idTokenFlag = flag.Bool("id-token", false, "Use ID token")
 	var jwtFlag = flag.Bool("jwt", false, "Use JWT")
+	var firebaseIDTokenFlag = flag.Bool("firebase-id-token", false, "Use Firebase ID token exchanged from custom token")
 
 	// token sources
-	var keyFile = flag.String("key-file", "", "Service Account JSON Key")
+	var keyFile = flag.String("key-file", "", "Service Account JSON Key(- means stdin)")
+	var keyJSONEnv = flag.String("key-json-env", "", "Environment variable which contains Service Account JSON Key")
+	var keyCommand = flag.String("key-command", "", "Shell command which prints Service Account JSON Key to stdout")
 	var gcloudFlag = flag.Bool("gcloud", false, "gcloud default account")
 	var wellKnownFlag = flag.Bool("well-known", false, "well known file credential")
+	var projectFlag = flag.String("project", "", "Project to resolve short service account names(default: detected from credential)")
 	var gcloudAccount = flag.String("gcloud-account", "", "gcloud registered account(implies --gcloud)")
+	var gcloudConfiguration = flag.String("gcloud-configuration", "", "gcloud named configuration(implies --gcloud)")
+	var noGcloudImpersonationFlag = flag.Bool("no-gcloud-impersonation", false, "Ignore auth/impersonate_service_account property of gcloud")
+	var forceRefreshFlag = flag.Bool("force-refresh", false, "Force refresh of gcloud credential")
 	var metadataFlag = flag.Bool("metadata", false, "Use metadata token source")
+	var cloudShellFlag = flag.Bool("cloud-shell", false, "Use Cloud Shell credential server")
+	var autoFlag = flag.Bool("auto", false, "Find credential in the order of Application Default Credentials(default when no credential source is given)")
+	var credentialName = flag.String("credential", "", "Use credential stored by ocurl login")
+	// generic OAuth2/OIDC provider
+	var oidcIssuer = flag.String("oidc-issuer", "", "OIDC issuer URL of generic provider")
+	var oidcTokenURL = flag.String("oidc-token-url", "", "Token endpoint of generic provider(default: discovered from --oidc-issuer)")
+	var oidcClientID = flag.String("oidc-client-id", "", "OAuth client ID of generic provider")
+	var oidcClientSecret = flag.String("oidc-client-secret", "", "OAuth client secret of generic provider(default: $OCURL_OIDC_CLIENT_SECRET)")
+	var oidcGrantType = flag.String("oidc-grant-type", grantClientCredentials, "Grant type of generic provider(client_credentials, refresh_token, password)")
+	var oidcRefreshToken = flag.String("oidc-refresh-token", "", "Refresh token for refresh_token grant(default: $OCURL_OIDC_REFRESH_TOKEN)")
+	var oidcUsername = flag.String("oidc-username", "", "Username for password grant")
+	var oidcPasswordEnv = flag.String("oidc-password-env", "OCURL_OIDC_PASSWORD", "Environment variable of password for password grant")
+	var oidcParams keyValuesType
+	flag.Var(&oidcParams, "oidc-param", "Additional parameter of client_credentials grant in key=value form(repeatable)")
+
+	var tokenEnv = flag.String("token-env", "", "Use existing token in the environment variable")
+	var tokenFile = flag.String("token-file", "", "Use existing token in the file(re-read when modified)")
 
 	// impersonate chain
 	var impersonateServiceAccount stringsType
-	flag.Var(&impersonateServiceAccount, "impersonate-service-account", "Specify delegate chain(near to far order). Implies --gcloud")
+	flag.Var(&impersonateServiceAccount, "impersonate-service-account", "Specify delegate chain(near to far order). Accepts email, name, name@project or unique ID")
 
 	// action
 	var printTokenFlag = flag.Bool("print-token", false, "Print token")
-	var tokenInfoFlag = flag.Bool("token-info", false, "Print token info")
+	var outputFlag = flag.String("output", "", "Output format of --print-token(raw, json, env, header, template)(implies --print-token)")
+	var outputTemplate = flag.String("output-template", "", "Go text/template for --output=template. Fields are same as --output=json")
+
+	// cache
+	var noCacheFlag = flag.Bool("no-cache", false, "Don't use persistent token cache")
+	var cacheMinTTL = flag.Duration("cache-min-ttl", defaultCacheMinTTL, "Reuse cached token while it remains valid for this duration")
+	var tokenInfoFlag = flag.Bool("token-info", false, "Print token info. JWT is decoded locally")
+	var tokenInfoEndpoint = flag.String("token-info-endpoint", defaultTokenInfoEndpoint, "tokeninfo endpoint of --token-info")
 	var decodeTokenFlag = flag.Bool("decode-token", false, "Print local decoded token")
-
-	// id token option
-	var audience = flag.String("audience", "", "Audience")
+	var verifyKeys = flag.String("verify-keys", "", "Verify signature of --decode-token by key set: google, service account email, JWKS URL or local JWKS file")
+	var expectAudience = flag.String("expect-audience", "", "Check aud claim of --decode-token")
+	var expectIssuer = flag.String("expect-issuer", "", "Check iss claim of --decode-token. Required for --verify-keys other than Google and service account key sets")
+	var diagnoseFlag = flag.Bool("diagnose-impersonation", false, "Diagnose --impersonate-service-account chain hop by hop")
+	var testIamPermissionsFlag = flag.Bool("test-iam-permissions", false, "Run testIamPermissions on each hop(implies --diagnose-impersonation)")
+
+	// id token and jwt option
+	var audiences stringsType
+	flag.Var(&audiences, "audience", "Audience(repeatable for --jwt)")
+
+	// jwt option
+	var extraClaims claimsType
+	flag.Var(&extraClaims, "claim", "Additional JWT claim in key=value form(repeatable). Value is parsed as JSON if possible. Developer claims for --firebase-id-token")
+	var claimsFile = flag.String("claims-file", "", "JSON file of additional JWT claims")
+	var lifetime = flag.Duration("lifetime", 0, "Token lifetime of --jwt or impersonated --access-token(default 1h)")
+
+	// kms option
+	var kmsKey = flag.String("kms-key", "", "Sign --jwt by Cloud KMS key version(projects/.../cryptoKeyVersions/N)")
+	var kmsEndpoint = flag.String("kms-endpoint", "", "Cloud KMS endpoint")
+
+	// firebase option
+	var firebaseUID = flag.String("firebase-uid", "", "uid of Firebase custom token")
+	var firebaseTenant = flag.String("firebase-tenant", "", "Identity Platform tenant ID")
+	var firebaseAPIKey = flag.String("firebase-api-key", "", "Web API key of Firebase project")
+	var firebaseEndpoint = flag.String("firebase-endpoint", "", "Identity Toolkit endpoint(default: Auth emulator if $FIREBASE_AUTH_EMULATOR_HOST is set)")
+
+	// impersonation option
+	var rawSourceScopes stringsType
+	flag.Var(&rawSourceScopes, "source-scopes", "Scopes of source credential for impersonation(default iam)")
+	var includeEmail = flag.Bool("include-email", true, "Include email claims in impersonated ID token")
 
 	// access token option
 	var rawScopes stringsType
@@ -64,13 +144,27 @@ func main() {
 
 	flag.Parse()
 
-	delegateChain, serviceAccount := splitInitLast(impersonateServiceAccount)
+	if *outputFlag != "" {
+		*printTokenFlag = true
+	}
 
-	// --gcloud-account implies --gcloud
-	if *gcloudAccount != "" {
+	serviceAccount := lastOrEmpty(impersonateServiceAccount)
+
+	var audience string
+	if len(audiences) > 0 {
+		audience = audiences[0]
+	}
+
+	// --gcloud-account and --gcloud-configuration implies --gcloud
+	if *gcloudAccount != "" || *gcloudConfiguration != "" {
 		*gcloudFlag = true
 	}
 
+	// --test-iam-permissions implies --diagnose-impersonation
+	if *testIamPermissionsFlag {
+		*diagnoseFlag = true
+	}
+
 	// adjust action
 	switch {
 	case *decodeTokenFlag && *accessTokenFlag:
@@ -83,64 +177,208 @@ func main() {
 		*decodeTokenFlag = true
 	}
 
-	keyEnv := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	sourceCount := countTrue(*autoFlag, *gcloudFlag, *metadataFlag, *cloudShellFlag, *wellKnownFlag, *keyFile != "", *keyJSONEnv != "", *keyCommand != "", *credentialName != "", *oidcIssuer != "" || *oidcTokenURL != "", *tokenEnv != "", *tokenFile != "")
+	// auto is the default credential source
+	autoSource := *autoFlag || sourceCount == 0
 
 	switch {
-	case countTrue(*idTokenFlag, *accessTokenFlag, *jwtFlag) == 0:
-		log.Fatalln("--id-token or --access-token or --jwt is required")
-	case countTrue(*idTokenFlag, *accessTokenFlag, *jwtFlag) > 1:
-		log.Fatalln("--id-token and --access-token and --jwt are exclusive")
-	case countTrue(*gcloudFlag, *metadataFlag, *wellKnownFlag, *keyFile != "", keyEnv != "") == 0:
-		log.Fatalln("credential source is required")
-	case countTrue(*gcloudFlag, *metadataFlag, *wellKnownFlag, *keyFile != "") > 1:
+	case countTrue(*idTokenFlag, *accessTokenFlag, *jwtFlag, *firebaseIDTokenFlag) == 0:
+		log.Fatalln("--id-token or --access-token or --jwt or --firebase-id-token is required")
+	case countTrue(*idTokenFlag, *accessTokenFlag, *jwtFlag, *firebaseIDTokenFlag) > 1:
+		log.Fatalln("--id-token and --access-token and --jwt and --firebase-id-token are exclusive")
+	case sourceCount > 1:
 		log.Fatalln("credential source are exclusive")
-	case *idTokenFlag && serviceAccount != "" && *audience == "":
+	case *idTokenFlag && serviceAccount != "" && audience == "":
 		log.Fatalln("--audience is required when --id-token is used")
+	case *idTokenFlag && len(audiences) > 1:
+		log.Fatalln("--id-token can't work with multiple --audience")
 	case *idTokenFlag && len(rawScopes) != 0:
 		log.Fatalln("--id-token and --scopes are exclusive")
-	case *accessTokenFlag && *audience != "":
+	case *accessTokenFlag && audience != "":
 		log.Fatalln("--access-token and --audience are exclusive")
+	case !*jwtFlag && !*firebaseIDTokenFlag && (len(extraClaims) != 0 || *claimsFile != ""):
+		log.Fatalln("--claim and --claims-file require --jwt or --firebase-id-token")
+	case *kmsKey != "" && !*jwtFlag:
+		log.Fatalln("--kms-key requires --jwt")
+	case *lifetime < 0 || (*lifetime != 0 && *lifetime < time.Second):
+		log.Fatalln("--lifetime must be at least 1s")
+	case *firebaseIDTokenFlag && *firebaseUID == "":
+		log.Fatalln("--firebase-uid is required when --firebase-id-token is used")
+	case *firebaseIDTokenFlag && (len(audiences) != 0 || len(rawScopes) != 0):
+		log.Fatalln("--firebase-id-token can't work with --audience and --scopes")
+	case *outputFlag != "" && !contains(outputFormats, *outputFlag):
+		log.Fatalf("unknown --output format %s: must be one of %s", *outputFlag, strings.Join(outputFormats, ", "))
+	case (*outputFlag == "template") != (*outputTemplate != ""):
+		log.Fatalln("--output=template and --output-template must be used together")
 	case *printTokenFlag && *tokenInfoFlag:
 		log.Fatalln("--print-token and --token-info are exclusive")
+	case *keyFile == "-" && !(*printTokenFlag || *tokenInfoFlag || *decodeTokenFlag) && curlReadsStdin(flag.Args()):
+		log.Fatalln("--key-file - consumes stdin, so curl can't read it")
 	case (*printTokenFlag || *tokenInfoFlag || *decodeTokenFlag) && flag.NArg() > 0:
 		log.Fatalln("remaining argument is not permitted when --print-token or --token-info or --decode-token")
+	case (*verifyKeys != "" || *expectAudience != "" || *expectIssuer != "") && !*decodeTokenFlag:
+		log.Fatalln("--verify-keys, --expect-audience and --expect-issuer require --decode-token")
+	case *forceRefreshFlag && !*gcloudFlag && !autoSource:
+		log.Fatalln("--force-refresh requires --gcloud or --auto")
+	case *noGcloudImpersonationFlag && !*gcloudFlag && !autoSource:
+		log.Fatalln("--no-gcloud-impersonation requires --gcloud or --auto")
 	}
 
+	isOIDC := *oidcIssuer != "" || *oidcTokenURL != ""
+
+	// scopes of generic provider are passed as is
 	scopes := normalizeScopes(rawScopes)
-	if len(scopes) == 0 {
+	switch {
+	case isOIDC:
+		scopes = rawScopes
+	case len(scopes) == 0:
 		scopes = defaultScopes
 	}
 
+	sourceScopes := normalizeScopes(rawSourceScopes)
+	if len(sourceScopes) == 0 {
+		sourceScopes = defaultSourceScopes
+	}
+
+	jwtOpt := jwtOption{Audiences: audiences, Lifetime: *lifetime}
+	if *claimsFile != "" {
+		fileClaims, err := readClaimsFile(*claimsFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		jwtOpt.Claims = fileClaims
+	}
+	for k, v := range extraClaims {
+		if jwtOpt.Claims == nil {
+			jwtOpt.Claims = make(map[string]interface{})
+		}
+		jwtOpt.Claims[k] = v
+	}
+
 	var err error
 	var tokenSource TokenSource
 	switch {
 	case *gcloudFlag:
-		tokenSource, err = GcloudTokenSource(*gcloudAccount)
+		tokenSource, err = GcloudTokenSourceWithOption(gcloudOption{
+			Account:       *gcloudAccount,
+			Configuration: *gcloudConfiguration,
+			ForceRefresh:  *forceRefreshFlag,
+			// explicit --impersonate-service-account starts from the gcloud account itself
+			NoImpersonation: *noGcloudImpersonationFlag || serviceAccount != "",
+		})
 	case *wellKnownFlag:
 		tokenSource, err = WellKnownTokenSource()
 	case *keyFile != "":
 		tokenSource, err = KeyFileTokenSourceFromFile(*keyFile)
+	case *keyJSONEnv != "":
+		tokenSource, err = KeyFileTokenSourceFromEnv(*keyJSONEnv)
+	case *keyCommand != "":
+		tokenSource, err = KeyFileTokenSourceFromCommand(*keyCommand)
 	case *metadataFlag:
 		tokenSource, err = MetadataTokenSourceDefault()
-	case keyEnv != "":
-		tokenSource, err = KeyFileTokenSourceFromFile(keyEnv)
+	case *cloudShellFlag:
+		tokenSource, err = CloudShellTokenSource()
+	case isOIDC:
+		tokenSource, err = OIDCTokenSource(context.Background(), oidcOption{
+			Issuer:       *oidcIssuer,
+			TokenURL:     *oidcTokenURL,
+			ClientID:     *oidcClientID,
+			ClientSecret: orDefault(*oidcClientSecret, os.Getenv("OCURL_OIDC_CLIENT_SECRET")),
+			GrantType:    *oidcGrantType,
+			RefreshToken: orDefault(*oidcRefreshToken, os.Getenv("OCURL_OIDC_REFRESH_TOKEN")),
+			Username:     *oidcUsername,
+			Password:     os.Getenv(*oidcPasswordEnv),
+			Params:       oidcParams,
+		})
+	case *credentialName != "":
+		tokenSource, err = StoredCredentialTokenSource(*credentialName)
+	case *tokenEnv != "":
+		tokenSource, err = StaticTokenSourceFromEnv(*tokenEnv)
+	case *tokenFile != "":
+		tokenSource, err = StaticTokenSourceFromFile(*tokenFile)
 	default:
-		log.Fatalln("token source is missing")
+		tokenSource, err = AutoTokenSource(gcloudOption{
+			ForceRefresh:    *forceRefreshFlag,
+			NoImpersonation: *noGcloudImpersonationFlag || serviceAccount != "",
+		})
 	}
 
 	if err != nil {
 		log.Fatalln(err)
 	}
+	baseSourceName := sourceName(tokenSource)
+	principal, _ := Email(tokenSource)
+
+	// act as the same identity as gcloud unless explicitly impersonated
+	if gts, ok := tokenSource.(*gcloudTokenSource); ok && serviceAccount == "" {
+		if chain := gts.ImpersonateServiceAccounts(); len(chain) > 0 {
+			log.Println("Use gcloud auth/impersonate_service_account:", strings.Join(chain, ","))
+			impersonateServiceAccount = chain
+			serviceAccount = lastOrEmpty(chain)
+			if *idTokenFlag && audience == "" {
+				log.Fatalln("--audience is required when --id-token is used with auth/impersonate_service_account")
+			}
+		}
+	}
+
+	switch {
+	case *lifetime != 0 && !*jwtFlag && !(*accessTokenFlag && serviceAccount != ""):
+		log.Fatalln("--lifetime requires --jwt or --access-token with --impersonate-service-account")
+	case *diagnoseFlag && serviceAccount == "":
+		log.Fatalln("--diagnose-impersonation requires --impersonate-service-account")
+	}
 
 	ctx := context.Background()
+	var resolvedChain []string
 	if serviceAccount != "" {
-		var oauth2TokenSource oauth2.TokenSource
-		oauth2TokenSource, err = OAuth2TokenSource(ctx, tokenSource, defaultScopes...)
+		oauth2TokenSource := LazyOAuth2TokenSource(ctx, tokenSource, sourceScopes...)
+
+		project := *projectFlag
+		if project == "" {
+			project, _ = Project(tokenSource)
+		}
+		var lookup func(ctx context.Context, uniqueID string) (string, error)
+		if needsLookup(impersonateServiceAccount) {
+			var lookupTokenSource oauth2.TokenSource
+			lookupTokenSource, err = OAuth2TokenSource(ctx, tokenSource, defaultScopes...)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			lookup = serviceAccountEmailLookup(lookupTokenSource)
+		}
+		chain, err := resolveServiceAccounts(ctx, impersonateServiceAccount, project, lookup)
 		if err != nil {
 			log.Fatalln(err)
 		}
+		resolvedChain = chain
+		delegateChain, serviceAccount := splitInitLast(chain)
+
+		if *diagnoseFlag {
+			caller, _ := Email(tokenSource)
+			d := chainDiagnosis{
+				Caller:             caller,
+				Chain:              chain,
+				Kind:               requestedKind(*idTokenFlag, *accessTokenFlag, *jwtFlag || *firebaseIDTokenFlag),
+				Audience:           audience,
+				TestIamPermissions: *testIamPermissionsFlag,
+			}
+			if err := diagnoseImpersonateChain(ctx, oauth2TokenSource, d, os.Stdout); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		}
 
-		tokenSource = ImpersonateTokenSource(oauth2TokenSource, serviceAccount, delegateChain...)
+		impersonateOpt := impersonateOption{Lifetime: *lifetime, IncludeEmail: *includeEmail}
+		tokenSource = ImpersonateTokenSourceWithOption(oauth2TokenSource, impersonateOpt, serviceAccount, delegateChain...)
+	}
+
+	if *kmsKey != "" {
+		oauth2TokenSource := LazyOAuth2TokenSource(ctx, tokenSource, defaultScopes...)
+		issuer, _ := jwtOpt.Claims["iss"].(string)
+		if issuer == "" {
+			issuer, _ = Email(tokenSource)
+		}
+		tokenSource = KMSTokenSource(oauth2TokenSource, *kmsKey, issuer, *kmsEndpoint)
 	}
 
 	if email, err := Email(tokenSource); err == nil {
@@ -149,16 +387,54 @@ func main() {
 		log.Println("Can't get email:", err)
 	}
 
+	fbOpt := firebaseOption{
+		UID:      *firebaseUID,
+		Claims:   jwtOpt.Claims,
+		TenantID: *firebaseTenant,
+		APIKey:   *firebaseAPIKey,
+		Endpoint: *firebaseEndpoint,
+	}
+	kind := requestedKind(*idTokenFlag, *accessTokenFlag, *jwtFlag)
+	if *firebaseIDTokenFlag {
+		kind = kindFirebaseIDToken
+	}
+	fetch := func() (string, error) {
+		switch kind {
+		case kindIDToken:
+			return IDToken(ctx, tokenSource, audience)
+		case kindAccessToken:
+			return AccessToken(ctx, tokenSource, scopes...)
+		case kindJWT:
+			return JWTToken(ctx, tokenSource, jwtOpt, sourceScopes...)
+		case kindFirebaseIDToken:
+			return FirebaseIDToken(ctx, tokenSource, fbOpt, sourceScopes...)
+		default:
+			return "", errors.New("unknown branch")
+		}
+	}
+
 	var tokenString string
-	switch {
-	case *idTokenFlag:
-		tokenString, err = IDToken(ctx, tokenSource, *audience)
-	case *accessTokenFlag:
-		tokenString, err = AccessToken(ctx, tokenSource, scopes...)
-	case *jwtFlag:
-		tokenString, err = JWTToken(ctx, tokenSource, *audience)
-	default:
-		log.Fatalln("unknown branch")
+	var expiry time.Time
+	if *noCacheFlag || *forceRefreshFlag || baseSourceName == "" {
+		tokenString, expiry, err = fetchWithExpiry(fetch, tokenExpiry(tokenSource))
+	} else {
+		key := cacheKey{
+			Source:    baseSourceName,
+			Principal: principal,
+			Chain:     resolvedChain,
+			Kind:      kind,
+			Audiences: audiences,
+			Options: map[string]interface{}{
+				"jwt":           jwtOpt,
+				"include_email": *includeEmail,
+				"kms_key":       *kmsKey,
+				"firebase":      fbOpt,
+			},
+		}
+		if kind == kindAccessToken {
+			key.Scopes = scopes
+		}
+		tokenString, expiry, err = newTokenCache(*cacheMinTTL).get(key, fetch, tokenExpiry(tokenSource))
 	}
 
 	if err != nil {
@@ -166,34 +442,68 @@ func main() {
 	}
 
 	if *printTokenFlag {
-		fmt.Println(tokenString)
+		out := tokenOutput{
+			Token:     tokenString,
+			Kind:      kind,
+			Audiences: audiences,
+			Source:    baseSourceName,
+		}
+		out.Principal, _ = Email(tokenSource)
+		if kind == kindAccessToken {
+			out.Scopes = scopes
+		}
+		if !expiry.IsZero() {
+			out.Expiry = &expiry
+			out.ExpiresIn = int64(time.Until(expiry).Seconds())
+		}
+		if err := writeTokenOutput(os.Stdout, &out, *outputFlag, *outputTemplate); err != nil {
+			log.Fatalln(err)
+		}
 		return
 	}
 
+	// JWT is self-contained, so it doesn't need tokeninfo endpoint
+	if *tokenInfoFlag && isJWT(tokenString) {
+		log.Println("--token-info: decode JWT locally")
+		*tokenInfoFlag = false
+		*decodeTokenFlag = true
+	}
+
 	if *tokenInfoFlag {
-		var resp *http.Response
-		if *idTokenFlag {
-			resp, err = http.Get("https://www.googleapis.com/oauth2/v3/tokeninfo?id_token=" + tokenString)
-		} else {
-			resp, err = http.Get("https://www.googleapis.com/oauth2/v3/tokeninfo?access_token=" + tokenString)
-		}
+		info, err := tokenInfo(ctx, *tokenInfoEndpoint, kind, tokenString)
 		if err != nil {
 			log.Fatalln(err)
 		}
-		_, err = io.Copy(os.Stdout, resp.Body)
+		b, err := json.MarshalIndent(info, "", "  ")
 		if err != nil {
 			log.Fatalln(err)
 		}
+		fmt.Println(string(b))
 		return
 	}
 
 	if *decodeTokenFlag {
-		var b []byte
-		b, err = decodeToken(tokenString)
+		var opt *verifyOption
+		if *verifyKeys != "" || *expectAudience != "" || *expectIssuer != "" {
+			opt = &verifyOption{
+				KeySet:      *verifyKeys,
+				Audience:    *expectAudience,
+				Issuer:      *expectIssuer,
+				KeySetCache: newKeySetCache(defaultKeySetMaxAge, false),
+			}
+		}
+		decoded, err := decodeToken(ctx, tokenString, opt)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		b, err := json.MarshalIndent(decoded, "", "  ")
 		if err != nil {
 			log.Fatalln(err)
 		}
 		fmt.Println(string(b))
+		if !allChecksOK(decoded.Checks) {
+			log.Fatalln("token verification failed")
+		}
 		return
 	}
 
@@ -210,6 +520,17 @@ func main() {
 	}
 }
 
+func requestedKind(idToken, accessToken, jwt bool) tokenKind {
+	switch {
+	case idToken:
+		return kindIDToken
+	case jwt:
+		return kindJWT
+	default:
+		return kindAccessToken
+	}
+}
+
 var openidScopes = []string{"openid", "profile", "email"}
 
 func normalizeScopes(rawScopes []string) []string {
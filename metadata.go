@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"net/url"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/compute/metadata"
 	"golang.org/x/oauth2"
@@ -11,6 +14,9 @@ import (
 
 type metadataTokenSource struct {
 	account string
+
+	mu     sync.Mutex
+	expiry time.Time
 }
 
 func MetadataTokenSource(account string) (*metadataTokenSource, error) {
@@ -32,9 +38,22 @@ func (mts *metadataTokenSource) AccessToken(ctx context.Context, scopes ...strin
 	if err != nil {
 		return "", err
 	}
+	mts.mu.Lock()
+	mts.expiry = token.Expiry
+	mts.mu.Unlock()
 	return token.AccessToken, nil
 }
 
+// Expiry returns expiry of the last issued access token.
+func (mts *metadataTokenSource) Expiry() (time.Time, error) {
+	mts.mu.Lock()
+	defer mts.mu.Unlock()
+	if mts.expiry.IsZero() {
+		return time.Time{}, errors.New("no access token is issued")
+	}
+	return mts.expiry, nil
+}
+
 func (mts *metadataTokenSource) IDToken(ctx context.Context, audience string) (string, error) {
 	params := make(url.Values)
 	params.Set("audience", audience)
@@ -45,7 +64,11 @@ func (mts *metadataTokenSource) IDToken(ctx context.Context, audience string) (s
 	return tokenString, err
 }
 
-func (mts *metadataTokenSource) Email(ctx context.Context, audience string) (string, error) {
+func (mts *metadataTokenSource) Project() (string, error) {
+	return metadata.ProjectID()
+}
+
+func (mts *metadataTokenSource) Email() (string, error) {
 	tokenString, err := metadata.Get("instance/service-accounts/" + orDefault(mts.account, "default") + "/email")
 	if err != nil {
 		return "", err
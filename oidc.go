@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// Grant types supported by oidcTokenSource.
+const (
+	grantClientCredentials = "client_credentials"
+	grantRefreshToken      = "refresh_token"
+	grantPassword          = "password"
+)
+
+// oidcOption configures generic OAuth2/OIDC provider.
+// TokenURL is discovered from Issuer if it is empty.
+type oidcOption struct {
+	Issuer       string
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	GrantType    string
+	RefreshToken string
+	Username     string
+	Password     string
+	// Params are additional parameters of client credentials grant like audience of Auth0.
+	Params map[string]string
+}
+
+type oidcTokenSource struct {
+	opt oidcOption
+
+	mu     sync.Mutex
+	tokens map[string]*oauth2.Token
+	last   *oauth2.Token
+}
+
+func OIDCTokenSource(ctx context.Context, opt oidcOption) (*oidcTokenSource, error) {
+	if opt.TokenURL == "" {
+		if opt.Issuer == "" {
+			return nil, errors.New("issuer or token endpoint is required")
+		}
+		discovery, err := discoverOIDC(ctx, opt.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		opt.TokenURL = discovery.TokenEndpoint
+	}
+	switch opt.GrantType {
+	case grantClientCredentials:
+	case grantRefreshToken:
+		if opt.RefreshToken == "" {
+			return nil, errors.New("refresh token is required for refresh_token grant")
+		}
+	case grantPassword:
+		if opt.Username == "" {
+			return nil, errors.New("username is required for password grant")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported grant type: %s", opt.GrantType)
+	}
+	return &oidcTokenSource{opt: opt, tokens: make(map[string]*oauth2.Token)}, nil
+}
+
+func (ots *oidcTokenSource) token(ctx context.Context, scopes []string) (*oauth2.Token, error) {
+	ots.mu.Lock()
+	defer ots.mu.Unlock()
+
+	key := fmt.Sprint(scopes)
+	if token, ok := ots.tokens[key]; ok && token.Valid() {
+		return token, nil
+	}
+
+	var token *oauth2.Token
+	var err error
+	switch ots.opt.GrantType {
+	case grantClientCredentials:
+		params := url.Values{}
+		for k, v := range ots.opt.Params {
+			params.Set(k, v)
+		}
+		cfg := &clientcredentials.Config{
+			ClientID:       ots.opt.ClientID,
+			ClientSecret:   ots.opt.ClientSecret,
+			TokenURL:       ots.opt.TokenURL,
+			Scopes:         scopes,
+			EndpointParams: params,
+		}
+		token, err = cfg.Token(ctx)
+	case grantRefreshToken:
+		token, err = ots.config(scopes).TokenSource(ctx, &oauth2.Token{RefreshToken: ots.opt.RefreshToken}).Token()
+	case grantPassword:
+		token, err = ots.config(scopes).PasswordCredentialsToken(ctx, ots.opt.Username, ots.opt.Password)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ots.tokens[key] = token
+	ots.last = token
+	return token, nil
+}
+
+func (ots *oidcTokenSource) config(scopes []string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     ots.opt.ClientID,
+		ClientSecret: ots.opt.ClientSecret,
+		Endpoint:     oauth2.Endpoint{TokenURL: ots.opt.TokenURL},
+		Scopes:       scopes,
+	}
+}
+
+func (ots *oidcTokenSource) AccessToken(ctx context.Context, scopes ...string) (string, error) {
+	token, err := ots.token(ctx, scopes)
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+func (ots *oidcTokenSource) IDTokenWithoutAudience(ctx context.Context) (string, error) {
+	token, err := ots.token(ctx, []string{"openid"})
+	if err != nil {
+		return "", err
+	}
+	idToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return "", errors.New("token response has no id_token")
+	}
+	return idToken, nil
+}
+
+// Email returns the email claim of ID token, or the username of password grant.
+func (ots *oidcTokenSource) Email() (string, error) {
+	ots.mu.Lock()
+	defer ots.mu.Unlock()
+	if ots.last != nil {
+		if email := tokenEmail(ots.last); email != "" {
+			return email, nil
+		}
+	}
+	if ots.opt.Username != "" {
+		return ots.opt.Username, nil
+	}
+	return "", errors.New("email is unknown before token is issued")
+}
+
+func (ots *oidcTokenSource) Expiry() (time.Time, error) {
+	ots.mu.Lock()
+	defer ots.mu.Unlock()
+	if ots.last == nil {
+		return time.Time{}, errors.New("no token is issued")
+	}
+	return ots.last.Expiry, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// tokenOutput is printed by --print-token.
+type tokenOutput struct {
+	Token     string     `json:"token"`
+	Kind      tokenKind  `json:"kind"`
+	Expiry    *time.Time `json:"expiry,omitempty"`
+	ExpiresIn int64      `json:"expires_in,omitempty"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	Audiences []string   `json:"audiences,omitempty"`
+	Principal string     `json:"principal,omitempty"`
+	Source    string     `json:"source,omitempty"`
+}
+
+// tokenEnvNames are names of environment variables printed by --output=env.
+var tokenEnvNames = map[tokenKind]string{
+	kindAccessToken:     "GOOGLE_OAUTH_ACCESS_TOKEN",
+	kindIDToken:         "GOOGLE_ID_TOKEN",
+	kindJWT:             "GOOGLE_JWT",
+	kindFirebaseIDToken: "FIREBASE_ID_TOKEN",
+}
+
+// outputFormats are formats of --output.
+var outputFormats = []string{"raw", "json", "env", "header", "template"}
+
+func writeTokenOutput(w io.Writer, out *tokenOutput, format, tmpl string) error {
+	switch format {
+	case "", "raw":
+		_, err := fmt.Fprintln(w, out.Token)
+		return err
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case "env":
+		_, err := fmt.Fprintf(w, "export %s=%s\n", tokenEnvNames[out.Kind], shellQuote(out.Token))
+		return err
+	case "header":
+		_, err := fmt.Fprintf(w, "Authorization: Bearer %s\n", out.Token)
+		return err
+	case "template":
+		t, err := template.New("output").Parse(tmpl)
+		if err != nil {
+			return err
+		}
+		if err := t.Execute(w, out); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w)
+		return err
+	default:
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+// shellQuote quotes s for POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const serviceAccountDomain = ".iam.gserviceaccount.com"
+
+// resolveServiceAccount resolves short forms of service account into email.
+//
+//	name         -> name@project.iam.gserviceaccount.com
+//	name@project -> name@project.iam.gserviceaccount.com
+//	unique ID    -> email looked up by lookup
+//
+// Full emails are returned as is.
+func resolveServiceAccount(ctx context.Context, serviceAccount string, project string, lookup func(ctx context.Context, uniqueID string) (string, error)) (string, error) {
+	switch {
+	case isUniqueID(serviceAccount):
+		if lookup == nil {
+			return "", fmt.Errorf("can't resolve unique ID %s", serviceAccount)
+		}
+		return lookup(ctx, serviceAccount)
+	case !strings.Contains(serviceAccount, "@"):
+		if project == "" {
+			return "", fmt.Errorf("project is required to resolve %s, use --project", serviceAccount)
+		}
+		return serviceAccount + "@" + project + serviceAccountDomain, nil
+	case !strings.Contains(serviceAccount[strings.Index(serviceAccount, "@"):], "."):
+		return serviceAccount + serviceAccountDomain, nil
+	default:
+		return serviceAccount, nil
+	}
+}
+
+func resolveServiceAccounts(ctx context.Context, serviceAccounts []string, project string, lookup func(ctx context.Context, uniqueID string) (string, error)) ([]string, error) {
+	var resolved []string
+	for _, s := range serviceAccounts {
+		email, err := resolveServiceAccount(ctx, s, project, lookup)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, email)
+	}
+	return resolved, nil
+}
+
+func isUniqueID(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func needsLookup(serviceAccounts []string) bool {
+	for _, s := range serviceAccounts {
+		if isUniqueID(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/iam/v1"
+	"google.golang.org/api/option"
+)
+
+func serviceAccountEmailLookup(tokenSource oauth2.TokenSource) func(ctx context.Context, uniqueID string) (string, error) {
+	return func(ctx context.Context, uniqueID string) (string, error) {
+		service, err := iam.NewService(ctx, option.WithTokenSource(tokenSource))
+		if err != nil {
+			return "", err
+		}
+
+		response, err := service.Projects.ServiceAccounts.Get(toName(uniqueID)).Do()
+		if err != nil {
+			return "", err
+		}
+		return response.Email, nil
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// sqliteDB is a minimal read-only reader of SQLite database file.
+// It supports only full scan of rowid tables which is enough to read gcloud credential stores.
+type sqliteDB struct {
+	data       []byte
+	pageSize   int
+	usableSize int
+}
+
+const sqliteMagic = "SQLite format 3\x00"
+
+// Page types of b-tree.
+const (
+	sqliteInteriorTable = 0x05
+	sqliteLeafTable     = 0x0d
+)
+
+// sqliteMaxDepth limits the depth of b-tree. Real databases are far shallower.
+const sqliteMaxDepth = 32
+
+var errCorruptedSQLite = errors.New("corrupted SQLite database")
+
+func openSQLite(filename string) (*sqliteDB, error) {
+	// Uncommitted or un-checkpointed pages in write-ahead log are not visible in the main file.
+	if fi, err := os.Stat(filename + "-wal"); err == nil && fi.Size() > 0 {
+		return nil, fmt.Errorf("%s has write-ahead log", filename)
+	}
+	data, err := readSQLiteFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	db, err := newSQLiteDB(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return db, nil
+}
+
+func newSQLiteDB(data []byte) (*sqliteDB, error) {
+	if len(data) < 100 || string(data[:16]) != sqliteMagic {
+		return nil, errors.New("not SQLite database")
+	}
+	pageSize := int(binary.BigEndian.Uint16(data[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid SQLite page size: %d", pageSize)
+	}
+	usableSize := pageSize - int(data[20])
+	if usableSize < 480 {
+		return nil, fmt.Errorf("invalid SQLite usable size: %d", usableSize)
+	}
+	return &sqliteDB{
+		data:       data,
+		pageSize:   pageSize,
+		usableSize: usableSize,
+	}, nil
+}
+
+// readTable returns all rows of table as column name to value maps.
+// Values are int64, float64, string, []byte or nil.
+func (db *sqliteDB) readTable(table string) ([]map[string]interface{}, error) {
+	master, err := db.scan(1, 0, make(map[int]bool))
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range master {
+		// sqlite_master(type, name, tbl_name, rootpage, sql)
+		if len(row) < 5 || row[0] != "table" || row[1] != table {
+			continue
+		}
+		rootPage, ok := row[3].(int64)
+		if !ok || rootPage < 1 || rootPage > int64(db.pageCount()) {
+			return nil, fmt.Errorf("invalid rootpage of %s", table)
+		}
+		sql, _ := row[4].(string)
+		columns := sqliteColumns(sql)
+
+		records, err := db.scan(int(rootPage), 0, make(map[int]bool))
+		if err != nil {
+			return nil, err
+		}
+		var rows []map[string]interface{}
+		for _, record := range records {
+			m := make(map[string]interface{})
+			for i, c := range columns {
+				if i < len(record) {
+					m[c] = record[i]
+				} else {
+					// columns added by ALTER TABLE are missing in old records
+					m[c] = nil
+				}
+			}
+			rows = append(rows, m)
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("table %s is not found", table)
+}
+
+func (db *sqliteDB) pageCount() int {
+	return len(db.data) / db.pageSize
+}
+
+// scan walks table b-tree rooted at page and returns decoded records.
+// visited detects cycles of corrupted b-tree.
+func (db *sqliteDB) scan(page int, depth int, visited map[int]bool) ([][]interface{}, error) {
+	if depth > sqliteMaxDepth {
+		return nil, errors.New("SQLite b-tree is too deep")
+	}
+	if visited[page] {
+		return nil, fmt.Errorf("SQLite page %d is referenced twice", page)
+	}
+	visited[page] = true
+
+	b, headerOffset, err := db.page(page)
+	if err != nil {
+		return nil, err
+	}
+	h := b[headerOffset:]
+	if len(h) < 12 {
+		return nil, errCorruptedSQLite
+	}
+	cellCount := int(binary.BigEndian.Uint16(h[3:5]))
+	switch h[0] {
+	case sqliteLeafTable:
+		pointers, err := sqliteCellPointers(h, 8, cellCount)
+		if err != nil {
+			return nil, err
+		}
+		var records [][]interface{}
+		for _, offset := range pointers {
+			payload, err := db.leafPayload(b, offset)
+			if err != nil {
+				return nil, err
+			}
+			record, err := decodeSQLiteRecord(payload)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+		}
+		return records, nil
+	case sqliteInteriorTable:
+		pointers, err := sqliteCellPointers(h, 12, cellCount)
+		if err != nil {
+			return nil, err
+		}
+		var records [][]interface{}
+		for _, offset := range pointers {
+			if offset+4 > len(b) {
+				return nil, errCorruptedSQLite
+			}
+			child, err := db.scan(int(binary.BigEndian.Uint32(b[offset:])), depth+1, visited)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, child...)
+		}
+		rightMost, err := db.scan(int(binary.BigEndian.Uint32(h[8:12])), depth+1, visited)
+		if err != nil {
+			return nil, err
+		}
+		return append(records, rightMost...), nil
+	default:
+		return nil, fmt.Errorf("unsupported SQLite page type: %d", h[0])
+	}
+}
+
+// sqliteCellPointers returns cell offsets from the cell pointer array after the b-tree header of headerSize.
+func sqliteCellPointers(h []byte, headerSize int, cellCount int) ([]int, error) {
+	if headerSize+2*cellCount > len(h) {
+		return nil, errCorruptedSQLite
+	}
+	pointers := make([]int, cellCount)
+	for i := range pointers {
+		pointers[i] = int(binary.BigEndian.Uint16(h[headerSize+2*i:]))
+	}
+	return pointers, nil
+}
+
+// page returns the content of page and the offset of b-tree header in it.
+func (db *sqliteDB) page(page int) ([]byte, int, error) {
+	if page < 1 || page > db.pageCount() {
+		return nil, 0, fmt.Errorf("SQLite page %d is out of range", page)
+	}
+	start := (page - 1) * db.pageSize
+	headerOffset := 0
+	if page == 1 {
+		headerOffset = 100
+	}
+	return db.data[start : start+db.pageSize], headerOffset, nil
+}
+
+// leafPayload returns the payload of table leaf cell including overflow pages.
+func (db *sqliteDB) leafPayload(b []byte, offset int) ([]byte, error) {
+	if offset >= len(b) {
+		return nil, errCorruptedSQLite
+	}
+	size, n := sqliteVarint(b[offset:])
+	if n == 0 || size < 0 || size > int64(len(db.data)) {
+		return nil, errCorruptedSQLite
+	}
+	offset += n
+	_, n = sqliteVarint(b[offset:]) // rowid
+	if n == 0 {
+		return nil, errCorruptedSQLite
+	}
+	offset += n
+
+	u := db.usableSize
+	x := u - 35
+	local := int(size)
+	if local > x {
+		m := ((u-12)*32/255 - 23)
+		k := m + (int(size)-m)%(u-4)
+		if k <= x {
+			local = k
+		} else {
+			local = m
+		}
+	}
+	if offset+local > len(b) {
+		return nil, errCorruptedSQLite
+	}
+	payload := append([]byte(nil), b[offset:offset+local]...)
+	if local == int(size) {
+		return payload, nil
+	}
+
+	if offset+local+4 > len(b) {
+		return nil, errCorruptedSQLite
+	}
+	overflow := int(binary.BigEndian.Uint32(b[offset+local:]))
+	visited := make(map[int]bool)
+	for overflow != 0 && len(payload) < int(size) {
+		if visited[overflow] {
+			return nil, errors.New("corrupted SQLite overflow chain")
+		}
+		visited[overflow] = true
+		p, _, err := db.page(overflow)
+		if err != nil {
+			return nil, err
+		}
+		n := int(size) - len(payload)
+		if n > u-4 {
+			n = u - 4
+		}
+		payload = append(payload, p[4:4+n]...)
+		overflow = int(binary.BigEndian.Uint32(p[:4]))
+	}
+	if len(payload) != int(size) {
+		return nil, errors.New("corrupted SQLite overflow chain")
+	}
+	return payload, nil
+}
+
+func decodeSQLiteRecord(payload []byte) ([]interface{}, error) {
+	headerSize, n := sqliteVarint(payload)
+	if n == 0 || headerSize < int64(n) || headerSize > int64(len(payload)) {
+		return nil, errors.New("corrupted SQLite record")
+	}
+	header := payload[:headerSize]
+	var serialTypes []int64
+	for pos := n; pos < len(header); {
+		t, n := sqliteVarint(header[pos:])
+		if n == 0 || t < 0 || t == 10 || t == 11 || t > int64(2*len(payload)+13) {
+			return nil, errors.New("corrupted SQLite record")
+		}
+		serialTypes = append(serialTypes, t)
+		pos += n
+	}
+
+	body := payload[headerSize:]
+	var values []interface{}
+	for _, t := range serialTypes {
+		size := sqliteSerialSize(t)
+		if size > len(body) {
+			return nil, errors.New("corrupted SQLite record")
+		}
+		v := body[:size]
+		body = body[size:]
+		switch {
+		case t == 0:
+			values = append(values, nil)
+		case t >= 1 && t <= 6:
+			values = append(values, sqliteInt(v))
+		case t == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(v)))
+		case t == 8:
+			values = append(values, int64(0))
+		case t == 9:
+			values = append(values, int64(1))
+		case t >= 12 && t%2 == 0:
+			values = append(values, append([]byte(nil), v...))
+		default:
+			values = append(values, string(v))
+		}
+	}
+	return values, nil
+}
+
+func sqliteSerialSize(t int64) int {
+	switch {
+	case t >= 12:
+		return int((t - 12) / 2)
+	case t == 5:
+		return 6
+	case t == 6, t == 7:
+		return 8
+	case t >= 1 && t <= 4:
+		return int(t)
+	default:
+		return 0
+	}
+}
+
+// sqliteInt decodes big-endian two's complement integer.
+func sqliteInt(b []byte) int64 {
+	var v int64
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// sqliteVarint decodes SQLite variable-length integer and returns it and its length.
+// The length is 0 if b is truncated.
+func sqliteVarint(b []byte) (int64, int) {
+	var v int64
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			return v<<8 | int64(b[i]), 9
+		}
+		v = v<<7 | int64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// sqliteColumns extracts column names from CREATE TABLE statement.
+func sqliteColumns(sql string) []string {
+	start := strings.Index(sql, "(")
+	end := strings.LastIndex(sql, ")")
+	if start < 0 || end < start {
+		return nil
+	}
+	var columns []string
+	for _, def := range strings.Split(sql[start+1:end], ",") {
+		fields := strings.Fields(def)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PRIMARY", "UNIQUE", "CONSTRAINT", "FOREIGN", "CHECK":
+			continue
+		}
+		columns = append(columns, strings.Trim(fields[0], "\"`[]"))
+	}
+	return columns
+}
@@ -0,0 +1,51 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+const sqliteReadRetries = 3
+
+// readSQLiteFile reads filename without locks.
+// The file change counter in the header is re-read to detect a concurrent writer.
+func readSQLiteFile(filename string) ([]byte, error) {
+	for i := 0; i < sqliteReadRetries; i++ {
+		if fi, err := os.Stat(filename + "-journal"); err == nil && fi.Size() > 0 {
+			return nil, errors.New(filename + " is being written or has hot journal")
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		header, err := readSQLiteHeader(filename)
+		if err != nil {
+			return nil, err
+		}
+		// offset 24 is the file change counter
+		if len(data) >= 28 && len(header) >= 28 && bytes.Equal(data[24:28], header[24:28]) {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is modified while reading", filename)
+}
+
+func readSQLiteHeader(filename string) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	header := make([]byte, 100)
+	n, err := f.Read(header)
+	if err != nil {
+		return nil, err
+	}
+	return header[:n], nil
+}
@@ -0,0 +1,87 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Lock bytes of SQLite rollback journal mode. See os_unix.c of SQLite.
+const (
+	sqlitePendingByte  = 0x40000000
+	sqliteReservedByte = sqlitePendingByte + 1
+	sqliteSharedFirst  = sqlitePendingByte + 2
+	sqliteSharedSize   = 510
+
+	sqliteBusyTimeout = time.Second
+)
+
+// readSQLiteFile reads filename holding SHARED lock of SQLite so a concurrent writer like gcloud can't modify it while reading.
+func readSQLiteFile(filename string) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	// closing f releases the locks
+	defer f.Close()
+
+	deadline := time.Now().Add(sqliteBusyTimeout)
+	for {
+		err := sqliteLockShared(f)
+		if err == nil {
+			break
+		}
+		if err != syscall.EAGAIN && err != syscall.EACCES {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is locked", filename)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+
+	// Hot journal is left by a crashed writer. It must be rolled back by SQLite before reading.
+	if fi, err := os.Stat(filename + "-journal"); err == nil && fi.Size() > 0 {
+		reserved, err := sqliteLocked(f, sqliteReservedByte, 1)
+		if err != nil {
+			return nil, err
+		}
+		if !reserved {
+			return nil, errors.New(filename + " has hot journal")
+		}
+	}
+	return ioutil.ReadAll(f)
+}
+
+// sqliteLockShared acquires SHARED lock in the same way as SQLite.
+// PENDING byte is read-locked while acquiring to avoid starving writers.
+func sqliteLockShared(f *os.File) error {
+	if err := sqliteFlock(f, syscall.F_RDLCK, sqlitePendingByte, 1); err != nil {
+		return err
+	}
+	err := sqliteFlock(f, syscall.F_RDLCK, sqliteSharedFirst, sqliteSharedSize)
+	if unlockErr := sqliteFlock(f, syscall.F_UNLCK, sqlitePendingByte, 1); err == nil {
+		err = unlockErr
+	}
+	return err
+}
+
+func sqliteFlock(f *os.File, typ int16, start, length int64) error {
+	lk := syscall.Flock_t{Type: typ, Whence: 0, Start: start, Len: length}
+	return syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &lk)
+}
+
+// sqliteLocked reports whether the range is write-locked by other processes.
+func sqliteLocked(f *os.File, start, length int64) (bool, error) {
+	lk := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: 0, Start: start, Len: length}
+	if err := syscall.FcntlFlock(f.Fd(), syscall.F_GETLK, &lk); err != nil {
+		return false, err
+	}
+	return lk.Type != syscall.F_UNLCK, nil
+}
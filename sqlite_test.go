@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Fixtures in testdata are created by SQLite with the schemas of gcloud credential stores.
+func TestSQLiteReadTable(t *testing.T) {
+	for _, tt := range []struct {
+		file    string
+		table   string
+		rows    int
+		account string
+		want    map[string]interface{}
+	}{
+		{
+			file: "access_tokens.db", table: "access_tokens", rows: 2, account: "me@example.com",
+			want: map[string]interface{}{"access_token": "ya29.me", "token_expiry": "2026-10-19 01:00:00.123456", "rapt_token": nil, "id_token": "eyJ.id.token"},
+		},
+		{
+			file: "access_tokens.db", table: "access_tokens", rows: 2, account: "sa@p.iam.gserviceaccount.com",
+			want: map[string]interface{}{"access_token": "ya29.sa", "id_token": nil},
+		},
+		{
+			// the record inserted before ALTER TABLE lacks id_token column
+			file: "access_tokens_altered.db", table: "access_tokens", rows: 2, account: "old@example.com",
+			want: map[string]interface{}{"access_token": "ya29.old", "id_token": nil},
+		},
+		{
+			file: "access_tokens_altered.db", table: "access_tokens", rows: 2, account: "new@example.com",
+			want: map[string]interface{}{"access_token": "ya29.new", "id_token": "eyJ.new"},
+		},
+		{
+			// interior pages
+			file: "credentials_many.db", table: "credentials", rows: 300, account: "user299@example.com",
+			want: map[string]interface{}{"value": []byte(`{"type":"authorized_user","refresh_token":"1//299"}`)},
+		},
+		{
+			// overflow pages
+			file: "credentials_overflow.db", table: "credentials", rows: 1, account: "big@example.com",
+			want: map[string]interface{}{"value": []byte(`{"k":"` + strings.Repeat("x", 20000) + `"}`)},
+		},
+	} {
+		t.Run(tt.file+"/"+tt.account, func(t *testing.T) {
+			db, err := openSQLite(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows, err := db.readTable(tt.table)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != tt.rows {
+				t.Fatalf("got %d rows, want %d", len(rows), tt.rows)
+			}
+			row := findRow(rows, tt.account)
+			if row == nil {
+				t.Fatalf("%s is not found", tt.account)
+			}
+			for k, want := range tt.want {
+				if got := row[k]; !sqliteValueEqual(got, want) {
+					t.Errorf("%s: got %.40v, want %.40v", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSQLiteTableNotFound(t *testing.T) {
+	db, err := openSQLite(filepath.Join("testdata", "access_tokens.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.readTable("credentials"); err == nil {
+		t.Error("want error")
+	}
+}
+
+// TestSQLiteCorrupted checks corrupted files cause errors instead of panics.
+func TestSQLiteCorrupted(t *testing.T) {
+	for _, file := range []string{"access_tokens.db", "access_tokens_altered.db", "credentials_many.db", "credentials_overflow.db"} {
+		t.Run(file, func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			read := func(data []byte) {
+				db, err := newSQLiteDB(data)
+				if err != nil {
+					return
+				}
+				_, _ = db.readTable("access_tokens")
+				_, _ = db.readTable("credentials")
+			}
+			for n := 0; n < len(data); n += 97 {
+				read(data[:n])
+			}
+			for i := 0; i < len(data); i += 13 {
+				corrupted := append([]byte(nil), data...)
+				corrupted[i] ^= 0xff
+				read(corrupted)
+			}
+		})
+	}
+}
+
+func TestSQLiteCycle(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "credentials_many.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := newSQLiteDB(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// root page of credentials is an interior page. Point its right-most child to itself.
+	const root = 2
+	header := data[(root-1)*db.pageSize:]
+	if header[0] != sqliteInteriorTable {
+		t.Fatalf("page %d is not interior page", root)
+	}
+	binary.BigEndian.PutUint32(header[8:12], root)
+	if _, err := db.readTable("credentials"); err == nil || !strings.Contains(err.Error(), "referenced twice") {
+		t.Errorf("want cycle error, got %v", err)
+	}
+}
+
+func TestReadGcloudAccessToken(t *testing.T) {
+	token, idToken, err := readGcloudAccessToken("testdata", "me@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "ya29.me" || idToken != "eyJ.id.token" {
+		t.Errorf("got %q %q", token.AccessToken, idToken)
+	}
+	if _, _, err := readGcloudAccessToken("testdata", "unknown@example.com"); err == nil {
+		t.Error("want error for unknown account")
+	}
+}
+
+func findRow(rows []map[string]interface{}, account string) map[string]interface{} {
+	for _, row := range rows {
+		if row["account_id"] == account {
+			return row
+		}
+	}
+	return nil
+}
+
+func sqliteValueEqual(a, b interface{}) bool {
+	if ab, ok := a.([]byte); ok {
+		bb, ok := b.([]byte)
+		return ok && string(ab) == string(bb)
+	}
+	return a == b
+}
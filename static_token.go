@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// staticTokenSource serves a token which is issued by another tool.
+// JWT-shaped tokens are treated as ID tokens and others as access tokens.
+type staticTokenSource struct {
+	name string
+	load func() (string, error)
+}
+
+// StaticTokenSourceFromEnv reads a token from the environment variable.
+func StaticTokenSourceFromEnv(env string) (*staticTokenSource, error) {
+	token := strings.TrimSpace(os.Getenv(env))
+	if token == "" {
+		return nil, fmt.Errorf("environment variable %s is empty", env)
+	}
+	return &staticTokenSource{
+		name: "$" + env,
+		load: func() (string, error) { return token, nil },
+	}, nil
+}
+
+// StaticTokenSourceFromFile reads a token from the file.
+// The file is re-read when its modification time changes so rotated tokens are picked up.
+func StaticTokenSourceFromFile(filename string) (*staticTokenSource, error) {
+	f := &tokenFile{filename: filename}
+	if _, err := f.read(); err != nil {
+		return nil, err
+	}
+	return &staticTokenSource{name: filename, load: f.read}, nil
+}
+
+type tokenFile struct {
+	filename string
+
+	mu      sync.Mutex
+	modTime time.Time
+	token   string
+}
+
+func (tf *tokenFile) read() (string, error) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	fi, err := os.Stat(tf.filename)
+	if err != nil {
+		return "", err
+	}
+	if tf.token != "" && fi.ModTime().Equal(tf.modTime) {
+		return tf.token, nil
+	}
+	b, err := ioutil.ReadFile(tf.filename)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", tf.filename)
+	}
+	tf.token, tf.modTime = token, fi.ModTime()
+	return token, nil
+}
+
+func (sts *staticTokenSource) AccessTokenWithoutScopes(ctx context.Context) (string, error) {
+	token, err := sts.load()
+	if err != nil {
+		return "", err
+	}
+	if isJWT(token) {
+		return "", fmt.Errorf("token in %s is JWT, not access token", sts.name)
+	}
+	return token, nil
+}
+
+func (sts *staticTokenSource) IDTokenWithoutAudience(ctx context.Context) (string, error) {
+	token, err := sts.load()
+	if err != nil {
+		return "", err
+	}
+	if !isJWT(token) {
+		return "", fmt.Errorf("token in %s is not ID token", sts.name)
+	}
+	return token, nil
+}
+
+// Email returns email claim of JWT-shaped token.
+func (sts *staticTokenSource) Email() (string, error) {
+	claims, err := sts.claims()
+	if err != nil {
+		return "", err
+	}
+	if email, ok := claims["email"].(string); ok {
+		return email, nil
+	}
+	return "", errors.New("token hasn't email claim")
+}
+
+// Expiry returns exp claim of JWT-shaped token.
+func (sts *staticTokenSource) Expiry() (time.Time, error) {
+	claims, err := sts.claims()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		return time.Unix(int64(exp), 0), nil
+	}
+	return time.Time{}, errors.New("token hasn't exp claim")
+}
+
+func (sts *staticTokenSource) claims() (jwt.MapClaims, error) {
+	token, err := sts.load()
+	if err != nil {
+		return nil, err
+	}
+	if !isJWT(token) {
+		return nil, fmt.Errorf("token in %s is opaque", sts.name)
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// isJWT reports whether token is in JWS compact serialization.
+func isJWT(token string) bool {
+	if strings.Count(token, ".") != 2 {
+		return false
+	}
+	_, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	return err == nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultTokenInfoEndpoint = "https://www.googleapis.com/oauth2/v3/tokeninfo"
+
+// tokenInfo queries the tokeninfo endpoint.
+// The token is sent in POST body to keep it out of URLs logged by proxies.
+func tokenInfo(ctx context.Context, endpoint string, kind tokenKind, token string) (map[string]interface{}, error) {
+	param := "access_token"
+	if kind == kindIDToken {
+		param = "id_token"
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(url.Values{param: {token}}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var info map[string]interface{}
+	jsonErr := json.Unmarshal(body, &info)
+	if resp.StatusCode != http.StatusOK {
+		if desc, ok := info["error_description"].(string); ok {
+			return nil, fmt.Errorf("tokeninfo: %s: %s", resp.Status, desc)
+		}
+		return nil, fmt.Errorf("tokeninfo: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if jsonErr != nil {
+		return nil, fmt.Errorf("tokeninfo: invalid response: %v", jsonErr)
+	}
+	return info, nil
+}
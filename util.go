@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 )
@@ -18,6 +19,49 @@ func (ss *stringsType) Set(v string) error {
 	return nil
 }
 
+// claimsType is a flag.Value of key=value pairs.
+// A value is decoded as JSON if possible, otherwise it is treated as string.
+type claimsType map[string]interface{}
+
+func (ct *claimsType) String() string {
+	return fmt.Sprintf("%v", map[string]interface{}(*ct))
+}
+
+func (ct *claimsType) Set(v string) error {
+	kv := strings.SplitN(v, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("claim must be key=value: %s", v)
+	}
+	if *ct == nil {
+		*ct = make(claimsType)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(kv[1]), &value); err != nil {
+		value = kv[1]
+	}
+	(*ct)[kv[0]] = value
+	return nil
+}
+
+// keyValuesType is a flag.Value of key=value pairs of strings.
+type keyValuesType map[string]string
+
+func (kv *keyValuesType) String() string {
+	return fmt.Sprintf("%v", map[string]string(*kv))
+}
+
+func (kv *keyValuesType) Set(v string) error {
+	pair := strings.SplitN(v, "=", 2)
+	if len(pair) != 2 || pair[0] == "" {
+		return fmt.Errorf("must be key=value: %s", v)
+	}
+	if *kv == nil {
+		*kv = make(keyValuesType)
+	}
+	(*kv)[pair[0]] = pair[1]
+	return nil
+}
+
 func countTrue(bools ...bool) int {
 	count := 0
 	for _, b := range bools {
@@ -37,6 +81,16 @@ func contains(ss []string, s string) bool {
 	return false
 }
 
+// curlReadsStdin reports whether curl arguments read stdin like "-d @-", "-F file=@-" or "-T -".
+func curlReadsStdin(args []string) bool {
+	for _, arg := range args {
+		if arg == "-" || strings.HasSuffix(arg, "@-") || strings.HasSuffix(arg, "<-") {
+			return true
+		}
+	}
+	return false
+}
+
 func orDefault(v string, def string) string {
 	if v == "" {
 		return def
@@ -53,3 +107,8 @@ func splitInitLast(ss []string) ([]string, string) {
 	}
 	return initSlice, lastElement
 }
+
+func lastOrEmpty(ss []string) string {
+	_, last := splitInitLast(ss)
+	return last
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// verifyOption is expectations of a token.
+type verifyOption struct {
+	// KeySet is "google", a service account email, a JWKS URL or a local JWKS file. Signature isn't verified if empty.
+	KeySet   string
+	Audience string
+	Issuer   string
+	// Email is expected email claim like the service account of Pub/Sub push subscription.
+	Email string
+	// KeySetCache caches remote key sets. Key sets are fetched every time if nil.
+	KeySetCache *keySetCache
+}
+
+// tokenCheck is a result of a verification.
+type tokenCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// googleIssuers are iss claims of Google ID tokens.
+var googleIssuers = []string{"accounts.google.com", "https://accounts.google.com"}
+
+const (
+	iapIssuer = "https://cloud.google.com/iap"
+	// securetokenIssuerPrefix is followed by the project ID of Firebase ID tokens.
+	securetokenIssuerPrefix = "https://securetoken.google.com/"
+)
+
+// verifiedMethods are signing algorithms accepted by signature verification.
+var verifiedMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+func allChecksOK(checks []tokenCheck) bool {
+	for _, c := range checks {
+		if !c.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyToken verifies the signature and claims of tokenString.
+// Failed checks are reported in the result.
+// error is returned only when the key set can't be loaded or the issuer trusted for it is unknown.
+func verifyToken(ctx context.Context, tokenString string, claims jwt.MapClaims, opt verifyOption, now time.Time) ([]tokenCheck, error) {
+	var checks []tokenCheck
+	var issuers []string
+	if opt.Issuer != "" {
+		issuers = []string{opt.Issuer}
+	}
+	if opt.KeySet != "" {
+		var err error
+		issuers, err = trustedIssuers(opt)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := loadKeySet(ctx, opt.KeySet, opt.KeySetCache)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, checkSignature(tokenString, keys, opt.KeySet))
+	}
+	checks = append(checks, checkExpiry(claims, now))
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0)) {
+		checks = append(checks, tokenCheck{Name: "nbf", Detail: "token is not valid yet"})
+	}
+	if opt.Audience != "" {
+		checks = append(checks, checkAudience(claims, opt.Audience))
+	}
+	if issuers != nil {
+		checks = append(checks, checkIssuer(claims, issuers))
+	}
+	if opt.Email != "" {
+		email, _ := claims["email"].(string)
+		verified, _ := claims["email_verified"].(bool)
+		c := tokenCheck{Name: "email", OK: email == opt.Email && verified, Detail: email}
+		switch {
+		case email != opt.Email:
+			c.Detail = fmt.Sprintf("got %q, want %q", email, opt.Email)
+		case !verified:
+			c.Detail = "email is not verified"
+		}
+		checks = append(checks, c)
+	}
+	return checks, nil
+}
+
+// trustedIssuers returns iss claims which tokens signed by opt.KeySet are trusted to have.
+// Google key sets sign only their own issuers. Anyone can sign tokens by other key sets like a JWKS of a service account,
+// so their issuer must be expected explicitly by opt.Issuer or implied by the service account key set.
+func trustedIssuers(opt verifyOption) ([]string, error) {
+	var issuers []string
+	u, _ := keySetURL(opt.KeySet)
+	switch {
+	case u == googleCertsURL:
+		issuers = googleIssuers
+	case u == iapCertsURL:
+		issuers = []string{iapIssuer}
+	case u == securetokenCertsURL:
+		// project ID of Firebase ID tokens is their audience
+		if opt.Audience == "" {
+			return nil, errors.New("audience is required to verify Firebase ID tokens")
+		}
+		issuers = []string{securetokenIssuerPrefix + opt.Audience}
+	case strings.HasPrefix(u, serviceAccountCertsURL):
+		// opt.KeySet may be the email or the URL
+		email, err := url.PathUnescape(strings.TrimPrefix(u, serviceAccountCertsURL))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key set %s: %v", opt.KeySet, err)
+		}
+		issuers = []string{email}
+	}
+	switch {
+	case opt.Issuer == "" && issuers == nil:
+		return nil, fmt.Errorf("issuer must be expected to verify tokens by key set %s", opt.KeySet)
+	case opt.Issuer == "":
+		return issuers, nil
+	case issuers != nil && !contains(issuers, opt.Issuer):
+		return nil, fmt.Errorf("key set %s doesn't sign tokens of issuer %s", opt.KeySet, opt.Issuer)
+	default:
+		return []string{opt.Issuer}, nil
+	}
+}
+
+func checkIssuer(claims jwt.MapClaims, issuers []string) tokenCheck {
+	iss, _ := claims["iss"].(string)
+	if !contains(issuers, iss) {
+		return tokenCheck{Name: "iss", Detail: fmt.Sprintf("got %q, want %q", iss, strings.Join(issuers, " or "))}
+	}
+	return tokenCheck{Name: "iss", OK: true, Detail: iss}
+}
+
+func checkSignature(tokenString string, keys keySet, keySetName string) tokenCheck {
+	var kid string
+	parser := jwt.Parser{ValidMethods: verifiedMethods, SkipClaimsValidation: true}
+	_, err := parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ = token.Header["kid"].(string)
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+		if kid == "" && len(keys) == 1 {
+			for _, key := range keys {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("key %q is not found in %s", kid, keySetName)
+	})
+	if err != nil {
+		if verr, ok := err.(*jwt.ValidationError); ok && verr.Inner != nil {
+			err = verr.Inner
+		}
+		return tokenCheck{Name: "signature", Detail: err.Error()}
+	}
+	return tokenCheck{Name: "signature", OK: true, Detail: fmt.Sprintf("kid %q in %s", kid, keySetName)}
+}
+
+func checkExpiry(claims jwt.MapClaims, now time.Time) tokenCheck {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return tokenCheck{Name: "exp", Detail: "token hasn't exp claim"}
+	}
+	expiry := time.Unix(int64(exp), 0)
+	if !now.Before(expiry) {
+		return tokenCheck{Name: "exp", Detail: fmt.Sprintf("expired %s ago", now.Sub(expiry).Truncate(time.Second))}
+	}
+	return tokenCheck{Name: "exp", OK: true, Detail: fmt.Sprintf("expires in %s", expiry.Sub(now).Truncate(time.Second))}
+}
+
+func checkAudience(claims jwt.MapClaims, audience string) tokenCheck {
+	auds, err := audienceClaim(claims)
+	if err != nil {
+		return tokenCheck{Name: "aud", Detail: err.Error()}
+	}
+	if !contains(auds, audience) {
+		return tokenCheck{Name: "aud", Detail: fmt.Sprintf("got %q, want %q", strings.Join(auds, ","), audience)}
+	}
+	return tokenCheck{Name: "aud", OK: true, Detail: audience}
+}
+
+// audienceClaim returns aud claim which is a string or an array of strings.
+func audienceClaim(claims jwt.MapClaims) ([]string, error) {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}, nil
+	case []interface{}:
+		var auds []string
+		for _, v := range aud {
+			s, ok := v.(string)
+			if !ok {
+				return nil, errors.New("aud claim is not an array of strings")
+			}
+			auds = append(auds, s)
+		}
+		return auds, nil
+	case nil:
+		return nil, errors.New("token hasn't aud claim")
+	default:
+		return nil, errors.New("aud claim is neither string nor array")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// verifyCommand verifies a token received by a backend like Google ID token, IAP JWT, self-signed service account JWT and Pub/Sub push token.
+// It exits with non-zero status if any check fails.
+func verifyCommand(args []string) {
+	var opt verifyOption
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.StringVar(&opt.Audience, "audience", "", "Expected audience(required)")
+	fs.StringVar(&opt.Issuer, "issuer", "", "Expected issuer. Required other than Google issuers. Key set is discovered from it or certificates of the service account")
+	fs.StringVar(&opt.Email, "email", "", "Expected verified email claim(e.g. service account of Pub/Sub push subscription)")
+	fs.StringVar(&opt.KeySet, "keys", "", "Key set: google, service account email, JWKS URL or local JWKS file(default: chosen by issuer)")
+	offline := fs.Bool("offline", false, "Use only cached key sets")
+	maxAge := fs.Duration("keys-max-age", defaultKeySetMaxAge, "Refetch cached key sets older than this duration")
+	jsonFlag := fs.Bool("json", false, "Print decoded token and checks as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ocurl verify -audience AUDIENCE [flags] [TOKEN|-]")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if opt.Audience == "" {
+		log.Fatalln("--audience is required")
+	}
+	if fs.NArg() > 1 {
+		log.Fatalln("too many arguments")
+	}
+
+	tokenString, err := readVerifiedToken(fs.Arg(0), os.Stdin)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	ctx := context.Background()
+	if opt.KeySet == "" {
+		opt.KeySet, err = keySetForToken(ctx, tokenString, opt.Issuer)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+	opt.KeySetCache = newKeySetCache(*maxAge, *offline)
+
+	decoded, err := decodeToken(ctx, tokenString, &opt)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if *jsonFlag {
+		b, err := json.MarshalIndent(decoded, "", "  ")
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Println(string(b))
+	} else {
+		printChecks(os.Stdout, decoded.Checks)
+	}
+	if !allChecksOK(decoded.Checks) {
+		os.Exit(1)
+	}
+}
+
+// readVerifiedToken reads the token from arg or r if arg is empty or "-".
+// "Bearer " prefix is removed to accept Authorization header value.
+func readVerifiedToken(arg string, r io.Reader) (string, error) {
+	tokenString := arg
+	if arg == "" || arg == "-" {
+		line, err := bufio.NewReader(r).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		tokenString = line
+	}
+	tokenString = strings.TrimSpace(tokenString)
+	tokenString = strings.TrimSpace(strings.TrimPrefix(tokenString, "Bearer "))
+	if tokenString == "" {
+		return "", fmt.Errorf("token is empty")
+	}
+	return tokenString, nil
+}
+
+// keySetForToken chooses the key set by iss claim.
+// Only Google issuers are trusted implicitly.
+// Key sets of other issuers including service accounts are chosen only if it is expected,
+// because iss claim isn't verified yet and anyone can sign tokens by their service account.
+func keySetForToken(ctx context.Context, tokenString string, expectedIssuer string) (string, error) {
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(tokenString, claims); err != nil {
+		return "", err
+	}
+	iss, _ := claims["iss"].(string)
+	switch {
+	case contains(googleIssuers, iss):
+		return "google", nil
+	case iss == iapIssuer:
+		return iapCertsURL, nil
+	case strings.HasPrefix(iss, securetokenIssuerPrefix):
+		return securetokenCertsURL, nil
+	case iss != "" && iss == expectedIssuer && strings.Contains(iss, "@") && !strings.Contains(iss, "/"):
+		// self-signed JWT of the service account
+		return iss, nil
+	case iss != "" && iss == expectedIssuer:
+		discovery, err := discoverOIDC(ctx, iss)
+		if err != nil {
+			return "", err
+		}
+		if discovery.JWKSURI == "" {
+			return "", fmt.Errorf("issuer %s doesn't provide jwks_uri", iss)
+		}
+		return discovery.JWKSURI, nil
+	default:
+		return "", fmt.Errorf("unknown issuer %q: specify --issuer or --keys", iss)
+	}
+}
+
+func printChecks(w io.Writer, checks []tokenCheck) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range checks {
+		result := "OK"
+		if !c.OK {
+			result = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result, c.Name, c.Detail)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	attackerAccount = "evil@attacker.iam.gserviceaccount.com"
+	victimAccount   = "sa@victim.iam.gserviceaccount.com"
+)
+
+// testSigner signs tokens by an RSA key published as a JWKS.
+type testSigner struct {
+	kid string
+	key *rsa.PrivateKey
+}
+
+func newTestSigner(t *testing.T, kid string) *testSigner {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{kid: kid, key: key}
+}
+
+func (s *testSigner) jwks(t *testing.T) []byte {
+	jwk, err := newJSONWebKey(s.kid, s.key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(jsonWebKeySet{Keys: []jsonWebKey{*jwk}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func (s *testSigner) sign(t *testing.T, iss, aud string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": iss,
+		"sub": iss,
+		"aud": aud,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = s.kid
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// offlineKeySetCache returns a key set cache which serves key sets of URLs without network.
+func offlineKeySetCache(t *testing.T, keySets map[string][]byte) *keySetCache {
+	kc := &keySetCache{dir: t.TempDir(), offline: true}
+	for u, b := range keySets {
+		if err := ioutil.WriteFile(kc.file(u), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return kc
+}
+
+func TestKeySetForToken(t *testing.T) {
+	attacker := newTestSigner(t, "attacker")
+	for _, tt := range []struct {
+		name           string
+		iss            string
+		expectedIssuer string
+		want           string
+		wantErr        bool
+	}{
+		{name: "google", iss: "https://accounts.google.com", want: "google"},
+		{name: "google without scheme", iss: "accounts.google.com", want: "google"},
+		{name: "iap", iss: iapIssuer, want: iapCertsURL},
+		{name: "securetoken", iss: securetokenIssuerPrefix + "project", want: securetokenCertsURL},
+		{name: "unexpected service account", iss: attackerAccount, wantErr: true},
+		{name: "service account expected another", iss: attackerAccount, expectedIssuer: victimAccount, wantErr: true},
+		{name: "expected service account", iss: victimAccount, expectedIssuer: victimAccount, want: victimAccount},
+		{name: "unknown issuer", iss: "https://issuer.example.com", wantErr: true},
+		{name: "no issuer", wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := keySetForToken(context.Background(), attacker.sign(t, tt.iss, "aud"), tt.expectedIssuer)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("keySetForToken() = %s, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("keySetForToken() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyTokenIssuer(t *testing.T) {
+	google := newTestSigner(t, "google")
+	iap := newTestSigner(t, "iap")
+	securetoken := newTestSigner(t, "securetoken")
+	victim := newTestSigner(t, "victim")
+	attacker := newTestSigner(t, "attacker")
+	cache := offlineKeySetCache(t, map[string][]byte{
+		googleCertsURL:      google.jwks(t),
+		iapCertsURL:         iap.jwks(t),
+		securetokenCertsURL: securetoken.jwks(t),
+		serviceAccountCertsURL + url.PathEscape(victimAccount):   victim.jwks(t),
+		serviceAccountCertsURL + url.PathEscape(attackerAccount): attacker.jwks(t),
+	})
+	attackerJWKS := filepath.Join(t.TempDir(), "jwks.json")
+	if err := ioutil.WriteFile(attackerJWKS, attacker.jwks(t), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name      string
+		token     string
+		opt       verifyOption
+		wantOK    bool
+		wantFail  string
+		wantError bool
+	}{
+		{
+			name:   "google",
+			token:  google.sign(t, "https://accounts.google.com", "aud"),
+			opt:    verifyOption{KeySet: "google"},
+			wantOK: true,
+		},
+		{
+			name:     "google key with service account issuer",
+			token:    google.sign(t, attackerAccount, "aud"),
+			opt:      verifyOption{KeySet: "google"},
+			wantFail: "iss",
+		},
+		{
+			name:     "attacker key with google issuer",
+			token:    attacker.sign(t, "https://accounts.google.com", "aud"),
+			opt:      verifyOption{KeySet: "google"},
+			wantFail: "signature",
+		},
+		{
+			name:     "iap key with google issuer",
+			token:    iap.sign(t, "https://accounts.google.com", "aud"),
+			opt:      verifyOption{KeySet: iapCertsURL},
+			wantFail: "iss",
+		},
+		{
+			name:   "iap",
+			token:  iap.sign(t, iapIssuer, "aud"),
+			opt:    verifyOption{KeySet: iapCertsURL},
+			wantOK: true,
+		},
+		{
+			name:   "securetoken",
+			token:  securetoken.sign(t, securetokenIssuerPrefix+"aud", "aud"),
+			opt:    verifyOption{KeySet: securetokenCertsURL},
+			wantOK: true,
+		},
+		{
+			name:     "securetoken of another project",
+			token:    securetoken.sign(t, securetokenIssuerPrefix+"other", "aud"),
+			opt:      verifyOption{KeySet: securetokenCertsURL},
+			wantFail: "iss",
+		},
+		{
+			name:      "securetoken with issuer of another project",
+			token:     securetoken.sign(t, securetokenIssuerPrefix+"other", "aud"),
+			opt:       verifyOption{KeySet: securetokenCertsURL, Issuer: securetokenIssuerPrefix + "other"},
+			wantError: true,
+		},
+		{
+			name:   "service account implied by key set",
+			token:  victim.sign(t, victimAccount, "aud"),
+			opt:    verifyOption{KeySet: victimAccount},
+			wantOK: true,
+		},
+		{
+			name:   "service account implied by key set URL",
+			token:  victim.sign(t, victimAccount, "aud"),
+			opt:    verifyOption{KeySet: serviceAccountCertsURL + url.PathEscape(victimAccount)},
+			wantOK: true,
+		},
+		{
+			name:   "service account key set URL with expected issuer",
+			token:  victim.sign(t, victimAccount, "aud"),
+			opt:    verifyOption{KeySet: serviceAccountCertsURL + url.PathEscape(victimAccount), Issuer: victimAccount},
+			wantOK: true,
+		},
+		{
+			name:     "attacker key set of victim issuer",
+			token:    attacker.sign(t, victimAccount, "aud"),
+			opt:      verifyOption{KeySet: attackerAccount},
+			wantFail: "iss",
+		},
+		{
+			name:     "attacker token with expected victim issuer",
+			token:    attacker.sign(t, victimAccount, "aud"),
+			opt:      verifyOption{KeySet: victimAccount, Issuer: victimAccount},
+			wantFail: "signature",
+		},
+		{
+			name:      "local key set without issuer",
+			token:     attacker.sign(t, attackerAccount, "aud"),
+			opt:       verifyOption{KeySet: attackerJWKS},
+			wantError: true,
+		},
+		{
+			name:     "local key set with another issuer",
+			token:    attacker.sign(t, attackerAccount, "aud"),
+			opt:      verifyOption{KeySet: attackerJWKS, Issuer: "https://issuer.example.com"},
+			wantFail: "iss",
+		},
+		{
+			name:      "google key set with non google issuer",
+			token:     google.sign(t, attackerAccount, "aud"),
+			opt:       verifyOption{KeySet: "google", Issuer: attackerAccount},
+			wantError: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opt.Audience = "aud"
+			tt.opt.KeySetCache = cache
+			claims := jwt.MapClaims{}
+			if _, _, err := new(jwt.Parser).ParseUnverified(tt.token, claims); err != nil {
+				t.Fatal(err)
+			}
+			checks, err := verifyToken(context.Background(), tt.token, claims, tt.opt, time.Now())
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("verifyToken() = %v, want error", checks)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := allChecksOK(checks); got != tt.wantOK {
+				t.Errorf("allChecksOK() = %v, want %v: %v", got, tt.wantOK, checks)
+			}
+			for _, c := range checks {
+				if !c.OK && c.Name != tt.wantFail {
+					t.Errorf("unexpected failure of %s: %s", c.Name, c.Detail)
+				}
+			}
+		})
+	}
+}
+
+// TestVerifyForgedServiceAccountJWT verifies the token of the attacker's service account
+// with only the audience like "ocurl verify -audience X".
+func TestVerifyForgedServiceAccountJWT(t *testing.T) {
+	attacker := newTestSigner(t, "attacker")
+	token := attacker.sign(t, attackerAccount, "https://example.com")
+	keySet, err := keySetForToken(context.Background(), token, "")
+	if err == nil {
+		t.Fatalf("keySetForToken() = %s, want error", keySet)
+	}
+	if !strings.Contains(err.Error(), "--issuer") {
+		t.Errorf("error should suggest --issuer: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"io/ioutil"
 
 	"golang.org/x/oauth2/google"
@@ -12,7 +13,11 @@ type wellKnownTokenSource struct {
 }
 
 func WellKnownTokenSource() (TokenSource, error) {
-	filename := wellKnownFile()
+	return CredentialsFileTokenSource(wellKnownFile())
+}
+
+// CredentialsFileTokenSource reads credential file in any format of Application Default Credentials.
+func CredentialsFileTokenSource(filename string) (TokenSource, error) {
 	b, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, err
@@ -32,3 +37,20 @@ func (wkts *wellKnownTokenSource) AccessToken(ctx context.Context, scopes ...str
 	}
 	return token.AccessToken, nil
 }
+
+// identity returns the type and a hash of fields identifying the credential for cache key.
+// authorized_user is identified by client_id and refresh_token, external_account by audience and subject_token_type.
+func (wkts *wellKnownTokenSource) identity() string {
+	var f struct {
+		Type                           string `json:"type"`
+		ClientID                       string `json:"client_id"`
+		RefreshToken                   string `json:"refresh_token"`
+		Audience                       string `json:"audience"`
+		SubjectTokenType               string `json:"subject_token_type"`
+		ServiceAccountImpersonationURL string `json:"service_account_impersonation_url"`
+	}
+	if err := json.Unmarshal(wkts.wellKnownJSON, &f); err != nil {
+		return fingerprint(string(wkts.wellKnownJSON))
+	}
+	return f.Type + ":" + fingerprint(f.ClientID, f.RefreshToken, f.Audience, f.SubjectTokenType, f.ServiceAccountImpersonationURL)
+}